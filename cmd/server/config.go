@@ -0,0 +1,149 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/nktks/cc-slack/internal/bot"
+	"github.com/nktks/cc-slack/internal/config"
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/rules"
+	"github.com/nktks/cc-slack/internal/server"
+)
+
+// configSource describes where the configuration comes from, so that it
+// can be read again on SIGHUP.
+type configSource struct {
+	path        string
+	rulesPath   string
+	ccusageCron string
+}
+
+// load reads the configuration at startup: the file, environment
+// variables and flags, with the Slack tokens resolved from their secret
+// sources. It validates the result.
+func (src configSource) load() (*config.Config, error) {
+	cfg, err := src.read()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range []struct {
+		dst               *string
+		primary, fallback string
+	}{
+		{&cfg.Token, "CC_NOTIFY_SLACK_TOKEN", "SLACK_TOKEN"},
+		{&cfg.AppToken, "CC_NOTIFY_SLACK_APP_TOKEN", ""},
+		{&cfg.SigningSecret, "CC_NOTIFY_SLACK_SIGNING_SECRET", ""},
+	} {
+		if *t.dst != "" {
+			continue
+		}
+		v, err := envWithFallback(t.primary, t.fallback)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", t.primary, err)
+		}
+		*t.dst = v
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// read reads the configuration file and fills unset values from
+// environment variables and flags. Tokens are left as the file sets them:
+// resolving them may run commands or prompt for a passphrase, so it is
+// done once at startup only.
+func (src configSource) read() (*config.Config, error) {
+	cfg := &config.Config{}
+	if src.path != "" {
+		var err error
+		if cfg, err = config.Load(src.path); err != nil {
+			return nil, err
+		}
+	}
+	setDefault(&cfg.Channel, cmp.Or(os.Getenv("CC_NOTIFY_SLACK_CHANNEL"), os.Getenv("SLACK_CHANNEL")))
+	setDefault(&cfg.MentionUser, os.Getenv("CC_NOTIFY_SLACK_USER_ID"))
+
+	if src.ccusageCron != "" {
+		cfg.Cron = append(cfg.Cron, config.Job{Name: "ccusage", Schedule: src.ccusageCron})
+	}
+	if src.rulesPath != "" {
+		set, err := rules.Load(src.rulesPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Set = *set
+	}
+	return cfg, nil
+}
+
+// reloader applies a new configuration to the running components.
+type reloader struct {
+	src     configSource
+	current *config.Config
+	handler *server.Handler
+	bot     *bot.Bot
+	cron    *scheduler
+}
+
+// apply pushes cfg to the handler, bot and cron scheduler.
+func (r *reloader) apply(cfg *config.Config) {
+	r.handler.Apply(server.Settings{
+		Channel:     cfg.Channel,
+		UserID:      cfg.MentionUser,
+		Routes:      cfg.Routes,
+		Team:        cfg.Users,
+		Rules:       cfg.RuleSet(),
+		Limits:      cfg.MessageLimits(),
+		Redactor:    redact.New(cfg.Redact),
+		Templates:   cfg.Templates,
+		Blocks:      cfg.BlockKit(),
+		Screenshots: cfg.Screenshots,
+	})
+	if r.bot != nil {
+		r.bot.SetAllowedUser(cfg.BotAllowedUser())
+		r.bot.SetTeam(cfg.Users)
+		r.bot.SetAccess(cfg.Access)
+		r.bot.SetReactions(cfg.Reactions)
+		r.bot.SetRedactor(redact.New(cfg.Redact))
+	}
+	r.cron.Apply(cfg.Cron, cfg.Channel)
+	r.current = cfg
+}
+
+// reload re-reads the configuration and applies it. The tokens resolved at
+// startup are kept. An invalid configuration is reported and the current
+// one is kept.
+func (r *reloader) reload() {
+	cfg, err := r.src.read()
+	if err != nil {
+		slog.Error("config reload failed, keeping current configuration", "error", err)
+		return
+	}
+	for _, t := range []struct{ next, current string }{
+		{cfg.Token, r.current.Token},
+		{cfg.AppToken, r.current.AppToken},
+		{cfg.SigningSecret, r.current.SigningSecret},
+	} {
+		if t.next != "" && t.next != t.current {
+			slog.Warn("config reload: token and signing secret changes take effect after restart")
+			break
+		}
+	}
+	cfg.Token, cfg.AppToken, cfg.SigningSecret = r.current.Token, r.current.AppToken, r.current.SigningSecret
+	if err := cfg.Validate(); err != nil {
+		slog.Error("config reload failed, keeping current configuration", "error", err)
+		return
+	}
+	r.apply(cfg)
+	slog.Info("config reloaded", "channel", cfg.Channel, "routes", len(cfg.Routes), "rules", len(cfg.Set.Rules), "cron_jobs", len(cfg.Cron))
+}
+
+func setDefault(dst *string, v string) {
+	if *dst == "" {
+		*dst = v
+	}
+}
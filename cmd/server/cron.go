@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/ccusage"
+	"github.com/nktks/cc-slack/internal/config"
+	"github.com/nktks/cc-slack/internal/slack"
+	"github.com/robfig/cron/v3"
+)
+
+// scheduler runs the configured cron jobs and replaces them on reload.
+type scheduler struct {
+	slack slack.Client
+
+	mu      sync.Mutex
+	cron    *cron.Cron
+	lastRun jobRun
+}
+
+// jobRun is the outcome of a cron job run.
+type jobRun struct {
+	Job string
+	At  time.Time
+	Err error
+}
+
+// LastRun returns the most recent job run, or a zero jobRun if no job ran yet.
+func (s *scheduler) LastRun() jobRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun
+}
+
+// Jobs returns the number of scheduled jobs.
+func (s *scheduler) Jobs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cron == nil {
+		return 0
+	}
+	return len(s.cron.Entries())
+}
+
+// Apply stops the running jobs and starts jobs. Jobs without a channel
+// post to defaultChannel.
+func (s *scheduler) Apply(jobs []config.Job, defaultChannel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cron != nil {
+		s.cron.Stop()
+		s.cron = nil
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	c := cron.New()
+	for _, j := range jobs {
+		channel := j.Channel
+		if channel == "" {
+			channel = defaultChannel
+		}
+		// Schedules were validated with the rest of the configuration.
+		if _, err := c.AddFunc(j.Schedule, func() { s.runCCUsage(channel) }); err != nil {
+			slog.Error("invalid cron schedule", "schedule", j.Schedule, "error", err)
+			continue
+		}
+		slog.Info("cron scheduled", "job", j.Name, "schedule", j.Schedule, "channel", channel)
+	}
+	c.Start()
+	s.cron = c
+}
+
+// Stop removes all jobs and waits until running jobs finish or ctx is done.
+func (s *scheduler) Stop(ctx context.Context) {
+	s.mu.Lock()
+	c := s.cron
+	s.cron = nil
+	s.mu.Unlock()
+	if c == nil {
+		return
+	}
+	select {
+	case <-c.Stop().Done():
+	case <-ctx.Done():
+		slog.Warn("cron job still running at shutdown")
+	}
+}
+
+func (s *scheduler) runCCUsage(channel string) {
+	err := s.postCCUsage(channel)
+	if err != nil {
+		slog.Error("ccusage report failed", "error", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun = jobRun{Job: "ccusage", At: time.Now(), Err: err}
+}
+
+func (s *scheduler) postCCUsage(channel string) error {
+	slog.Info("running ccusage weekly report")
+	data, err := ccusage.Run()
+	if err != nil {
+		return fmt.Errorf("run: %w", err)
+	}
+	text, err := ccusage.FormatSlackTable(data)
+	if err != nil {
+		return fmt.Errorf("format: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, _, err := s.slack.PostMessage(ctx, channel, slack.Text(text), ""); err != nil {
+		return fmt.Errorf("slack post: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/bot"
+	"github.com/nktks/cc-slack/internal/health"
+	"github.com/nktks/cc-slack/internal/server"
+	"github.com/nktks/cc-slack/internal/slack"
+)
+
+// authCheckInterval limits how often readiness probes call auth.test.
+const authCheckInterval = time.Minute
+
+// newHealthChecker registers the readiness checks of the running server.
+// b is nil when the reply bot is disabled.
+func newHealthChecker(client slack.Client, h *server.Handler, b *bot.Bot, cron *scheduler) *health.Checker {
+	var c health.Checker
+
+	c.Add("slack_auth", health.Cached(func(ctx context.Context) health.Result {
+		id, err := client.AuthTest(ctx)
+		if err != nil {
+			return health.Result{Status: health.Fail, Message: err.Error()}
+		}
+		return health.Result{Status: health.OK, Details: map[string]any{"team": id.Team, "user": id.User}}
+	}, authCheckInterval))
+
+	c.Add("socket_mode", func(ctx context.Context) health.Result {
+		if b == nil || b.AppToken == "" {
+			return health.Result{Status: health.OK, Message: "disabled"}
+		}
+		s := b.Socket()
+		r := health.Result{Status: health.OK, Message: s.State}
+		if !s.Since.IsZero() {
+			r.Details = map[string]any{"since": s.Since}
+		}
+		if s.State != "connected" {
+			r.Status = health.Fail
+		}
+		return r
+	})
+
+	c.Add("thread_store", func(ctx context.Context) health.Result {
+		return health.Result{Status: health.OK, Details: map[string]any{"sessions": h.Threads.Len()}}
+	})
+
+	c.Add("outbox", func(ctx context.Context) health.Result {
+		if h.Outbox == nil {
+			return health.Result{Status: health.OK, Message: "disabled"}
+		}
+		n := h.Outbox.Len()
+		r := health.Result{Status: health.OK, Details: map[string]any{"pending": n}}
+		if n > 0 {
+			r.Status = health.Warn
+			r.Message = "notifications are waiting for Slack"
+		}
+		return r
+	})
+
+	c.Add("cron", func(ctx context.Context) health.Result {
+		r := health.Result{Status: health.OK, Details: map[string]any{"jobs": cron.Jobs()}}
+		last := cron.LastRun()
+		if last.At.IsZero() {
+			r.Message = "no runs yet"
+			return r
+		}
+		r.Details["last_job"] = last.Job
+		r.Details["last_run"] = last.At
+		if last.Err != nil {
+			r.Status = health.Warn
+			r.Message = last.Err.Error()
+		}
+		return r
+	})
+
+	return &c
+}
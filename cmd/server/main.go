@@ -2,113 +2,230 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/nktks/cc-slack/internal/bot"
-	"github.com/nktks/cc-slack/internal/ccusage"
+	"github.com/nktks/cc-slack/internal/logging"
+	"github.com/nktks/cc-slack/internal/metrics"
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/secret"
 	"github.com/nktks/cc-slack/internal/server"
 	"github.com/nktks/cc-slack/internal/slack"
-	"github.com/robfig/cron/v3"
 )
 
 func main() {
 	port := flag.String("port", "19999", "server listen port")
+	configPath := flag.String("config", "", "YAML configuration file, reloaded on SIGHUP")
 	ccusageCron := flag.String("ccusage-cron", "", "cron schedule for ccusage weekly report (e.g. \"0 9 * * 1\")")
+	workers := flag.Int("workers", 4, "number of hook processing workers")
+	coalesceWindow := flag.Duration("coalesce-window", 0, "edit the previous message instead of posting when events of a session arrive within this window of its last post or update (e.g. 10s)")
+	rulesPath := flag.String("rules", "", "YAML file with event filtering rules")
+	outboxPath := flag.String("outbox", defaultStatePath("outbox.json"), "file storing notifications that failed to post (empty to disable)")
+	threadsPath := flag.String("threads", defaultStatePath("threads.json"), "file persisting session threads across restarts (empty to disable)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time allowed for draining hooks and the outbox on SIGINT/SIGTERM")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error. Message bodies are only logged in full at debug")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
 	flag.Parse()
 
-	token := envWithFallback("CC_NOTIFY_SLACK_TOKEN", "SLACK_TOKEN")
-	channel := envWithFallback("CC_NOTIFY_SLACK_CHANNEL", "SLACK_CHANNEL")
-	if token == "" || channel == "" {
-		log.Fatal("CC_NOTIFY_SLACK_TOKEN and CC_NOTIFY_SLACK_CHANNEL must be set")
+	if err := logging.Setup(os.Stderr, *logLevel, *logFormat); err != nil {
+		fatal("invalid logging flags", "error", err)
 	}
 
-	userID := os.Getenv("CC_NOTIFY_SLACK_USER_ID")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	slackClient := slack.New(token)
+	src := configSource{path: *configPath, rulesPath: *rulesPath, ccusageCron: *ccusageCron}
+	cfg, err := src.load()
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+
+	slackClient := slack.New(cfg.Token)
 
 	threads := server.NewThreadStore()
-	go func() {
-		for {
-			time.Sleep(1 * time.Hour)
-			threads.CleanOlderThan(30 * 24 * time.Hour)
+	if *threadsPath != "" {
+		if threads, err = server.LoadThreadStore(*threadsPath); err != nil {
+			fatal("failed to load thread store", "error", err)
 		}
-	}()
+		slog.Info("thread store loaded", "path", *threadsPath, "sessions", threads.Len())
+	}
+	saveThreads := func() {
+		if *threadsPath == "" {
+			return
+		}
+		if err := threads.Save(*threadsPath); err != nil {
+			slog.Error("failed to save thread store", "error", err)
+		}
+	}
+	go every(ctx, time.Hour, func() {
+		threads.CleanOlderThan(30 * 24 * time.Hour)
+		saveThreads()
+	})
 
 	h := &server.Handler{
-		Slack:         slackClient,
-		Channel:       channel,
-		UserID:  userID,
-		Threads:       threads,
+		Slack:   slackClient,
+		Threads: threads,
+		Queue:   server.NewQueue(*workers, 256),
+
+		CoalesceWindow: *coalesceWindow,
 	}
 
-	appToken := os.Getenv("CC_NOTIFY_SLACK_APP_TOKEN")
-	if appToken != "" {
-		var allowedUser string
-		if strings.HasPrefix(channel, "U") {
-			allowedUser = channel
-		} else {
-			allowedUser = userID
-		}
-		if allowedUser == "" {
-			log.Fatal("CC_NOTIFY_SLACK_USER_ID is required when bot is enabled with a channel (non-DM)")
+	if *outboxPath != "" {
+		outbox, err := server.OpenOutbox(*outboxPath)
+		if err != nil {
+			fatal("failed to open outbox", "error", err)
 		}
-
-		b := &bot.Bot{
-			AppToken:    appToken,
-			BotToken:    token,
-			AllowedUser: allowedUser,
-			Threads:     threads,
+		h.Outbox = outbox
+		flush := func() {
+			if err := h.FlushOutbox(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("outbox flush failed", "pending", outbox.Len(), "error", err)
+			}
 		}
 		go func() {
-			if err := b.Run(context.Background()); err != nil {
-				log.Fatalf("bot error: %v", err)
-			}
+			flush()
+			every(ctx, 30*time.Second, flush)
 		}()
-		log.Printf("bot started (allowed_user=%s)", allowedUser)
+		slog.Info("outbox enabled", "path", *outboxPath, "pending", outbox.Len())
 	}
 
-	if *ccusageCron != "" {
-		c := cron.New()
-		_, err := c.AddFunc(*ccusageCron, func() {
-			log.Printf("running ccusage weekly report")
-			data, err := ccusage.Run()
-			if err != nil {
-				log.Printf("ccusage run failed: %v", err)
-				return
-			}
-			text, err := ccusage.FormatSlackTable(data)
-			if err != nil {
-				log.Printf("ccusage format failed: %v", err)
-				return
-			}
-			if _, err := slackClient.PostMessage(channel, text, ""); err != nil {
-				log.Printf("ccusage slack post failed: %v", err)
-			}
-		})
-		if err != nil {
-			log.Fatalf("invalid ccusage-cron schedule: %v", err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hook", h.HandleHook)
+
+	var (
+		b       *bot.Bot
+		botDone chan struct{}
+	)
+	if cfg.BotEnabled() {
+		b = &bot.Bot{
+			AppToken:      cfg.AppToken,
+			BotToken:      cfg.Token,
+			SigningSecret: cfg.SigningSecret,
+			AllowedUser:   cfg.BotAllowedUser(),
+			Threads:       threads,
+			Team:          cfg.Users,
+			Access:        cfg.Access,
+			Reactions:     cfg.Reactions,
+			Redactor:      redact.New(cfg.Redact),
+			Prompts:       h,
+		}
+		if cfg.AppToken != "" {
+			botDone = make(chan struct{})
+			go func() {
+				defer close(botDone)
+				if err := b.Run(ctx); err != nil && ctx.Err() == nil {
+					fatal("bot error", "error", err)
+				}
+			}()
 		}
-		c.Start()
-		log.Printf("ccusage cron started (schedule=%s)", *ccusageCron)
+		if cfg.SigningSecret != "" {
+			mux.HandleFunc("/slack/events", b.HandleEvents)
+			mux.HandleFunc("/slack/interactivity", b.HandleInteractivity)
+		}
+		slog.Info("bot started", "socket_mode", cfg.AppToken != "", "http", cfg.SigningSecret != "", "allowed_user", cfg.BotAllowedUser(),
+			"team_members", len(cfg.Users), "access_users", len(cfg.Access.Users), "access_groups", len(cfg.Access.Groups))
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/hook", h.HandleHook)
+	r := &reloader{
+		src:     src,
+		handler: h,
+		bot:     b,
+		cron:    &scheduler{slack: slackClient},
+	}
+	r.apply(cfg)
+
+	checker := newHealthChecker(slackClient, h, b, r.cron)
+	mux.HandleFunc("/healthz", checker.HandleLive)
+	mux.HandleFunc("/readyz", checker.HandleReady)
+	mux.Handle("/metrics", metrics.Handler())
 
-	addr := fmt.Sprintf(":%s", *port)
-	log.Printf("listening on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			r.reload()
+		}
+	}()
+
+	srv := &http.Server{Addr: fmt.Sprintf(":%s", *port), Handler: mux}
+	go func() {
+		slog.Info("listening", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			fatal("http server failed", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting hooks and wait for in-flight requests.
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("http shutdown", "error", err)
+	}
+	if err := h.Drain(shutdownCtx); err != nil {
+		slog.Warn("drain", "error", err)
+	}
+	if h.Outbox != nil && h.Outbox.Len() > 0 {
+		slog.Warn("notifications left in the outbox for the next start", "pending", h.Outbox.Len())
+	}
+	r.cron.Stop(shutdownCtx)
+	if botDone != nil {
+		select {
+		case <-botDone:
+		case <-shutdownCtx.Done():
+			slog.Warn("socket mode client did not stop in time")
+		}
+	}
+	saveThreads()
+	slog.Info("shutdown complete")
+}
+
+// fatal logs msg at error level and exits with status 1.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// every calls f every interval until ctx is done.
+func every(ctx context.Context, interval time.Duration, f func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			f()
+		}
+	}
+}
+
+// defaultStatePath returns the location of a state file under the user
+// cache directory.
+func defaultStatePath(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "cc-slack", name)
 }
 
-func envWithFallback(primary, fallback string) string {
-	if v := os.Getenv(primary); v != "" {
-		return v
+// envWithFallback resolves the secret named primary, or fallback if
+// primary is not set in any source. See secret.Lookup for the sources.
+func envWithFallback(primary, fallback string) (string, error) {
+	if fallback == "" {
+		return secret.Lookup(primary)
 	}
-	return os.Getenv(fallback)
+	return secret.LookupWithFallback(primary, fallback)
 }
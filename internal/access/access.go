@@ -0,0 +1,158 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what a Slack user may do in notification threads.
+// Higher roles include the permissions of lower ones.
+type Role int
+
+const (
+	// None may not see or act on sessions through the bot.
+	None Role = iota
+	// Viewer sees notifications but cannot act on them.
+	Viewer
+	// Approver may answer permission prompts.
+	Approver
+	// Operator may also send free-form prompts and keystrokes.
+	Operator
+)
+
+var roleNames = map[Role]string{
+	None:     "none",
+	Viewer:   "viewer",
+	Approver: "approver",
+	Operator: "operator",
+}
+
+func (r Role) String() string {
+	if s, ok := roleNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole parses a role name such as "approver".
+func ParseRole(s string) (Role, error) {
+	for r, name := range roleNames {
+		if r != None && name == s {
+			return r, nil
+		}
+	}
+	return None, fmt.Errorf("unknown role %q (want viewer, approver or operator)", s)
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	v, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// ACL grants roles to Slack users and user groups.
+type ACL struct {
+	// Users maps Slack user IDs (U...) to roles.
+	Users map[string]Role `yaml:"users"`
+	// Groups maps Slack user group IDs (S...) to roles.
+	Groups map[string]Role `yaml:"groups"`
+}
+
+// Empty reports whether the ACL grants no roles.
+func (a ACL) Empty() bool {
+	return len(a.Users) == 0 && len(a.Groups) == 0
+}
+
+// Validate checks the IDs in the ACL.
+func (a ACL) Validate() error {
+	var errs []error
+	for _, id := range slices.Sorted(maps.Keys(a.Users)) {
+		if !strings.HasPrefix(id, "U") && !strings.HasPrefix(id, "W") {
+			errs = append(errs, fmt.Errorf("access.users: %q is not a user ID (U...)", id))
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(a.Groups)) {
+		if !strings.HasPrefix(id, "S") {
+			errs = append(errs, fmt.Errorf("access.groups: %q is not a user group ID (S...)", id))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GroupMembers lists the user IDs in a Slack user group.
+type GroupMembers func(ctx context.Context, groupID string) ([]string, error)
+
+// groupTTL is how long user group memberships are cached.
+const groupTTL = 5 * time.Minute
+
+// Resolver computes a user's role from an ACL, resolving user groups
+// through the Slack API with caching.
+type Resolver struct {
+	Members GroupMembers
+
+	mu     sync.Mutex
+	groups map[string]cachedGroup
+}
+
+type cachedGroup struct {
+	members []string
+	fetched time.Time
+}
+
+// Role returns the highest role acl grants to user. Groups whose members
+// cannot be fetched are skipped.
+func (r *Resolver) Role(ctx context.Context, acl ACL, user string) Role {
+	role := acl.Users[user]
+	for _, id := range slices.Sorted(maps.Keys(acl.Groups)) {
+		groupRole := acl.Groups[id]
+		if groupRole <= role {
+			continue
+		}
+		members, err := r.members(ctx, id)
+		if err != nil {
+			continue
+		}
+		if slices.Contains(members, user) {
+			role = groupRole
+		}
+	}
+	return role
+}
+
+func (r *Resolver) members(ctx context.Context, groupID string) ([]string, error) {
+	r.mu.Lock()
+	cached, ok := r.groups[groupID]
+	r.mu.Unlock()
+	if ok && time.Since(cached.fetched) < groupTTL {
+		return cached.members, nil
+	}
+	if r.Members == nil {
+		return nil, errors.New("user group lookup is not configured")
+	}
+
+	members, err := r.Members(ctx, groupID)
+	if err != nil {
+		if ok {
+			// Keep using the stale list rather than locking people out.
+			return cached.members, nil
+		}
+		return nil, fmt.Errorf("list members of %s: %w", groupID, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.groups == nil {
+		r.groups = make(map[string]cachedGroup)
+	}
+	r.groups[groupID] = cachedGroup{members: members, fetched: time.Now()}
+	return members, nil
+}
@@ -0,0 +1,115 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, want := range []Role{Viewer, Approver, Operator} {
+		got, err := ParseRole(want.String())
+		if err != nil || got != want {
+			t.Errorf("ParseRole(%q) = %v, %v, want %v", want.String(), got, err, want)
+		}
+	}
+	for _, s := range []string{"none", "admin", ""} {
+		if _, err := ParseRole(s); err == nil {
+			t.Errorf("ParseRole(%q) should fail", s)
+		}
+	}
+}
+
+func TestACLYAML(t *testing.T) {
+	var acl ACL
+	err := yaml.Unmarshal([]byte("users:\n  U1: approver\ngroups:\n  S1: viewer\n"), &acl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if acl.Users["U1"] != Approver || acl.Groups["S1"] != Viewer {
+		t.Errorf("acl = %+v", acl)
+	}
+	if err := yaml.Unmarshal([]byte("users:\n  U1: admin\n"), &acl); err == nil {
+		t.Error("expected error for unknown role")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := ACL{Users: map[string]Role{"U1": Viewer}, Groups: map[string]Role{"S1": Operator}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	invalid := ACL{Users: map[string]Role{"C1": Viewer}, Groups: map[string]Role{"U1": Operator}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected error for wrong ID prefixes")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	acl := ACL{
+		Users:  map[string]Role{"U1": Approver, "U2": Operator},
+		Groups: map[string]Role{"S1": Operator, "S2": Viewer},
+	}
+	calls := map[string]int{}
+	r := &Resolver{Members: func(ctx context.Context, groupID string) ([]string, error) {
+		calls[groupID]++
+		switch groupID {
+		case "S1":
+			return []string{"U1", "U3"}, nil
+		case "S2":
+			return []string{"U4"}, nil
+		}
+		return nil, errors.New("not found")
+	}}
+	ctx := context.Background()
+
+	t.Run("highest role wins", func(t *testing.T) {
+		if got := r.Role(ctx, acl, "U1"); got != Operator {
+			t.Errorf("role = %v, want operator", got)
+		}
+		if got := r.Role(ctx, acl, "U3"); got != Operator {
+			t.Errorf("role = %v, want operator", got)
+		}
+		if got := r.Role(ctx, acl, "U4"); got != Viewer {
+			t.Errorf("role = %v, want viewer", got)
+		}
+		if got := r.Role(ctx, acl, "U9"); got != None {
+			t.Errorf("role = %v, want none", got)
+		}
+	})
+
+	t.Run("group members are cached", func(t *testing.T) {
+		if calls["S1"] != 1 {
+			t.Errorf("S1 lookups = %d, want 1", calls["S1"])
+		}
+	})
+
+	t.Run("skips groups when the user already has a higher role", func(t *testing.T) {
+		r := &Resolver{Members: func(ctx context.Context, groupID string) ([]string, error) {
+			t.Errorf("unexpected lookup of %s", groupID)
+			return nil, nil
+		}}
+		if got := r.Role(ctx, acl, "U2"); got != Operator {
+			t.Errorf("role = %v, want operator", got)
+		}
+	})
+
+	t.Run("keeps stale members when the lookup fails", func(t *testing.T) {
+		fail := false
+		r := &Resolver{Members: func(ctx context.Context, groupID string) ([]string, error) {
+			if fail {
+				return nil, errors.New("slack is down")
+			}
+			return []string{"U3"}, nil
+		}}
+		r.Role(ctx, acl, "U3")
+		r.groups["S1"] = cachedGroup{members: r.groups["S1"].members, fetched: time.Now().Add(-time.Hour)}
+		fail = true
+		if got := r.Role(ctx, acl, "U3"); got != Operator {
+			t.Errorf("role = %v, want operator", got)
+		}
+	})
+}
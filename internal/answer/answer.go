@@ -0,0 +1,200 @@
+package answer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nktks/cc-slack/internal/tmux"
+)
+
+// Question is one question of an AskUserQuestion prompt.
+type Question struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	// MultiSelect questions accept several options.
+	MultiSelect bool `json:"multi_select,omitempty"`
+}
+
+// Questions returns the questions in an AskUserQuestion tool input.
+func Questions(toolInput json.RawMessage) []Question {
+	var in struct {
+		Questions []struct {
+			Question string `json:"question"`
+			Options  []struct {
+				Label string `json:"label"`
+			} `json:"options"`
+			MultiSelect bool `json:"multiSelect"`
+		} `json:"questions"`
+	}
+	if err := json.Unmarshal(toolInput, &in); err != nil {
+		return nil
+	}
+	var qs []Question
+	for _, q := range in.Questions {
+		labels := []string{}
+		for _, o := range q.Options {
+			labels = append(labels, o.Label)
+		}
+		qs = append(qs, Question{Question: q.Question, Options: labels, MultiSelect: q.MultiSelect})
+	}
+	return qs
+}
+
+// Prompt is the dialog a session is waiting on.
+type Prompt struct {
+	Tool string
+	// Options are the answers of a permission prompt. They may be unknown
+	// for prompts recorded by older versions.
+	Options []string
+	// Questions are set for AskUserQuestion.
+	Questions []Question
+}
+
+// Answer is a reply to a prompt translated into keystrokes.
+type Answer struct {
+	Keys []tmux.Key
+	// Summary describes what was chosen, such as the option label.
+	Summary string
+}
+
+// Parse translates reply into the keystrokes answering p in Claude Code's
+// terminal UI. Options are selected by moving down from the first one and
+// pressing Enter.
+//
+// A permission prompt is answered with an option number, "yes", "no",
+// "always" (don't ask again for this session) or an option label.
+// Each AskUserQuestion question is answered with an option number or
+// label, or any other text for its "Type something." option. Forms with
+// several questions take one answer per line, and are then submitted.
+//
+// If reply does not answer p, the error says which replies would.
+func Parse(p Prompt, reply string) (Answer, error) {
+	reply = strings.TrimSpace(reply)
+	if p.Tool != "AskUserQuestion" {
+		return permission(p.Options, reply)
+	}
+
+	questions := p.Questions
+	if len(questions) == 0 {
+		questions = []Question{{Options: p.Options}}
+	}
+	replies := []string{reply}
+	if len(questions) > 1 {
+		replies = strings.Split(reply, "\n")
+		if len(replies) != len(questions) {
+			return Answer{}, fmt.Errorf("this prompt has %d questions, reply with one answer per line", len(questions))
+		}
+	}
+
+	var a Answer
+	var summary []string
+	for i, q := range questions {
+		keys, label, err := question(q, strings.TrimSpace(replies[i]))
+		if err != nil {
+			if len(questions) > 1 {
+				err = fmt.Errorf("question %d: %w", i+1, err)
+			}
+			return Answer{}, err
+		}
+		a.Keys = append(a.Keys, keys...)
+		summary = append(summary, label)
+	}
+	if len(questions) > 1 {
+		// The form ends with a review of the answers, focused on Submit.
+		a.Keys = append(a.Keys, tmux.Named("Enter"))
+	}
+	a.Summary = strings.Join(summary, "; ")
+	return a, nil
+}
+
+// permission answers a permission prompt with options.
+func permission(options []string, reply string) (Answer, error) {
+	n, err := strconv.Atoi(reply)
+	switch {
+	case err == nil && n >= 1 && (len(options) == 0 || n <= len(options)):
+	case err == nil:
+		return Answer{}, invalid(options)
+	case strings.EqualFold(reply, "yes") || strings.EqualFold(reply, "y"):
+		n = find(options, func(o string) bool { return o == "Yes" || strings.HasPrefix(o, "Yes,") })
+	case strings.EqualFold(reply, "no") || strings.EqualFold(reply, "n"):
+		n = find(options, func(o string) bool { return o == "No" || strings.HasPrefix(o, "No,") })
+	case strings.EqualFold(reply, "always"):
+		n = find(options, func(o string) bool { return strings.HasSuffix(o, "this session") })
+	default:
+		n = find(options, func(o string) bool { return strings.EqualFold(o, reply) })
+	}
+	if n == 0 {
+		return Answer{}, invalid(options)
+	}
+	return Answer{Keys: choose(n), Summary: label(options, n)}, nil
+}
+
+// question answers one AskUserQuestion question. Claude Code lists
+// "Type something." and "Chat about this" after the options.
+func question(q Question, reply string) ([]tmux.Key, string, error) {
+	if q.MultiSelect {
+		return nil, "", errors.New("questions with several answers can only be answered at the terminal")
+	}
+	if reply == "" {
+		return nil, "", errors.New("reply with an option number, an option label or your own answer")
+	}
+	typeSomething, chat := len(q.Options)+1, len(q.Options)+2
+	if n, err := strconv.Atoi(reply); err == nil {
+		switch {
+		case n >= 1 && n <= len(q.Options):
+			return choose(n), q.Options[n-1], nil
+		case n == typeSomething:
+			return nil, "", fmt.Errorf("to type something, reply with your answer instead of %d", n)
+		case n == chat:
+			return choose(n), "Chat about this", nil
+		}
+		return nil, "", fmt.Errorf("reply with a number from 1 to %d, an option label or your own answer", len(q.Options))
+	}
+	if n := find(q.Options, func(o string) bool { return strings.EqualFold(o, reply) }); n > 0 {
+		return choose(n), q.Options[n-1], nil
+	}
+	// Focusing "Type something." turns it into a text field.
+	keys := append(moveDown(typeSomething), tmux.Literal(reply), tmux.Named("Enter"))
+	return keys, reply, nil
+}
+
+// choose selects option n.
+func choose(n int) []tmux.Key {
+	return append(moveDown(n), tmux.Named("Enter"))
+}
+
+// moveDown moves the cursor from the first option to option n.
+func moveDown(n int) []tmux.Key {
+	var keys []tmux.Key
+	for range n - 1 {
+		keys = append(keys, tmux.Named("Down"))
+	}
+	return keys
+}
+
+// find returns the number of the first option matching f, or 0.
+func find(options []string, f func(string) bool) int {
+	for i, o := range options {
+		if f(o) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func label(options []string, n int) string {
+	if n <= len(options) {
+		return options[n-1]
+	}
+	return "option " + strconv.Itoa(n)
+}
+
+func invalid(options []string) error {
+	if len(options) == 0 {
+		return errors.New("reply with the option number")
+	}
+	return fmt.Errorf("reply with a number from 1 to %d, yes, no, always or an option label", len(options))
+}
@@ -0,0 +1,131 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func keys(a Answer) string {
+	var s []string
+	for _, k := range a.Keys {
+		s = append(s, k.String())
+	}
+	return strings.Join(s, " ")
+}
+
+func TestParsePermission(t *testing.T) {
+	bash := Prompt{Tool: "Bash", Options: []string{"Yes", "Yes, and don't ask again for this session", "No"}}
+	plan := Prompt{Tool: "ExitPlanMode", Options: []string{"Yes, clear context and auto-accept edits (shift+tab)", "Yes, auto-accept edits", "Yes, manually approve edits"}}
+	legacy := Prompt{Tool: "Bash"}
+
+	tests := []struct {
+		name    string
+		prompt  Prompt
+		reply   string
+		want    string
+		summary string
+	}{
+		{"number", bash, " 1 ", "Enter", "Yes"},
+		{"last number", bash, "3", "Down Down Enter", "No"},
+		{"yes", bash, "Yes", "Enter", "Yes"},
+		{"no", bash, "n", "Down Down Enter", "No"},
+		{"always", bash, "always", "Down Enter", "Yes, and don't ask again for this session"},
+		{"label", bash, "yes, and don't ask again for this session", "Down Enter", "Yes, and don't ask again for this session"},
+		{"plan yes", plan, "yes", "Enter", plan.Options[0]},
+		{"unknown options", legacy, "2", "Down Enter", "option 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := Parse(tt.prompt, tt.reply)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := keys(a); got != tt.want {
+				t.Errorf("keys = %s, want %s", got, tt.want)
+			}
+			if a.Summary != tt.summary {
+				t.Errorf("summary = %q, want %q", a.Summary, tt.summary)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		prompt Prompt
+		reply  string
+	}{{bash, "4"}, {bash, "0"}, {bash, "run the tests"}, {plan, "no"}, {plan, "always"}, {legacy, "yes"}} {
+		if _, err := Parse(tc.prompt, tc.reply); err == nil {
+			t.Errorf("Parse(%s, %q) should fail", tc.prompt.Tool, tc.reply)
+		}
+	}
+}
+
+func TestParseQuestions(t *testing.T) {
+	db := Question{Question: "Which DB?", Options: []string{"Postgres", "SQLite"}}
+	ci := Question{Question: "Which CI?", Options: []string{"GitHub Actions", "CircleCI"}}
+	single := Prompt{Tool: "AskUserQuestion", Questions: []Question{db}}
+	form := Prompt{Tool: "AskUserQuestion", Questions: []Question{db, ci}}
+
+	tests := []struct {
+		name    string
+		prompt  Prompt
+		reply   string
+		want    string
+		summary string
+	}{
+		{"number", single, "2", "Down Enter", "SQLite"},
+		{"label", single, "postgres", "Enter", "Postgres"},
+		{"type something", single, "MySQL, please", `Down Down "MySQL, please" Enter`, "MySQL, please"},
+		{"chat about this", single, "4", "Down Down Down Enter", "Chat about this"},
+		{"options only", Prompt{Tool: "AskUserQuestion", Options: db.Options}, "SQLite", "Down Enter", "SQLite"},
+		{"form", form, "2\nGitHub Actions", "Down Enter Enter Enter", "SQLite; GitHub Actions"},
+		{"form with typed answer", form, "Postgres\nBuildkite", `Enter Down Down "Buildkite" Enter Enter`, "Postgres; Buildkite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := Parse(tt.prompt, tt.reply)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := keys(a); got != tt.want {
+				t.Errorf("keys = %s, want %s", got, tt.want)
+			}
+			if a.Summary != tt.summary {
+				t.Errorf("summary = %q, want %q", a.Summary, tt.summary)
+			}
+		})
+	}
+
+	multi := Prompt{Tool: "AskUserQuestion", Questions: []Question{{Options: []string{"a", "b"}, MultiSelect: true}}}
+	errs := []struct {
+		prompt Prompt
+		reply  string
+		want   string
+	}{
+		{single, "3", "reply with your answer instead of 3"},
+		{single, "9", "reply with a number from 1 to 2"},
+		{form, "1", "this prompt has 2 questions"},
+		{form, "1\n7", "question 2: reply with a number from 1 to 2"},
+		{multi, "1", "can only be answered at the terminal"},
+	}
+	for _, tt := range errs {
+		_, err := Parse(tt.prompt, tt.reply)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.reply, err, tt.want)
+		}
+	}
+}
+
+func TestQuestions(t *testing.T) {
+	input := json.RawMessage(`{"questions":[{"question":"Which DB?","options":[{"label":"Postgres","description":"x"},{"label":"SQLite"}]},` +
+		`{"question":"Features?","multiSelect":true,"options":[{"label":"Auth"}]}]}`)
+	got := fmt.Sprintf("%+v", Questions(input))
+	want := "[{Question:Which DB? Options:[Postgres SQLite] MultiSelect:false} {Question:Features? Options:[Auth] MultiSelect:true}]"
+	if got != want {
+		t.Errorf("Questions() = %s, want %s", got, want)
+	}
+	if got := Questions(json.RawMessage(`"not an object"`)); got != nil {
+		t.Errorf("Questions(invalid) = %+v, want nil", got)
+	}
+}
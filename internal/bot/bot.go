@@ -1,10 +1,23 @@
 package bot
 
 import (
+	"cmp"
 	"context"
-	"log"
+	"log/slog"
 	"regexp"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/nktks/cc-slack/internal/access"
+	"github.com/nktks/cc-slack/internal/answer"
+	"github.com/nktks/cc-slack/internal/logging"
+	"github.com/nktks/cc-slack/internal/metrics"
+	"github.com/nktks/cc-slack/internal/reaction"
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/render"
+	"github.com/nktks/cc-slack/internal/server"
+	"github.com/nktks/cc-slack/internal/team"
 	"github.com/nktks/cc-slack/internal/tmux"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -13,115 +26,419 @@ import (
 
 var mentionRe = regexp.MustCompile(`^<@[A-Z0-9]+>\s*`)
 
-// ThreadLookup finds the tmux target for a given thread_ts.
+// ThreadLookup finds the session thread for a given thread in a channel,
+// or for the message of its pending permission prompt.
 type ThreadLookup interface {
-	GetByThreadTS(threadTS string) (tmuxTarget string, ok bool)
+	GetByThreadTS(channel, threadTS string) (server.Thread, bool)
+	GetByPromptTS(channel, ts string) (server.Thread, bool)
+}
+
+// PromptResolver marks permission prompts as answered.
+type PromptResolver interface {
+	ResolvePrompt(channel, threadTS, user, answer string)
+}
+
+// slackAPI posts replies and files to threads, and messages only one user
+// can see.
+type slackAPI interface {
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+	UploadFileV2Context(ctx context.Context, params slack.UploadFileV2Parameters) (*slack.FileSummary, error)
+	PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error)
 }
 
 // Bot listens for app_mention and message events via Slack Socket Mode
-// and forwards messages to Claude Code via tmux send-keys.
+// or the HTTP Events API and forwards messages to Claude Code via tmux
+// send-keys.
 type Bot struct {
-	AppToken    string
-	BotToken    string
-	AllowedUser string
-	Threads     ThreadLookup
+	AppToken string
+	BotToken string
+	// SigningSecret verifies requests to the HTTP endpoints.
+	SigningSecret string
+	AllowedUser   string
+	Threads       ThreadLookup
+	// Team maps session owners to Slack users. Replies to a thread whose
+	// owner is in Team are accepted only from the owner and their delegates.
+	Team team.Directory
+	// Access grants roles to further users and user groups.
+	Access access.ACL
+	// Prompts, if set, is told when a reply answers a permission prompt.
+	Prompts PromptResolver
+	// Reactions map emoji reactions on a pending permission prompt to the
+	// option they choose. reaction.Default is used if empty.
+	Reactions reaction.Map
+	// Redactor masks secrets in terminal captures. redact.Default is used
+	// if nil.
+	Redactor *redact.Redactor
+
+	mu     sync.RWMutex
+	roles  access.Resolver
+	api    slackAPI
+	once   sync.Once
+	client *slack.Client
+	events eventLog
+	// serial handles Events API requests one at a time, in the order
+	// they arrive, as the Socket Mode event loop does.
+	serial serial
+	socket SocketState
+}
+
+// SocketState is the state of the Socket Mode connection.
+type SocketState struct {
+	// State is "disconnected", "connecting", "connected",
+	// "connection_error" or "invalid_auth".
+	State string
+	Since time.Time
+}
+
+// Socket returns the current Socket Mode connection state.
+func (b *Bot) Socket() SocketState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.socket.State == "" {
+		return SocketState{State: "disconnected"}
+	}
+	return b.socket
+}
+
+func (b *Bot) setSocketState(state string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.socket.State != state {
+		b.socket = SocketState{State: state, Since: time.Now()}
+	}
+}
+
+// slackClient returns the Slack Web API client, creating it on first use.
+func (b *Bot) slackClient() *slack.Client {
+	b.once.Do(func() {
+		var opts []slack.Option
+		if b.AppToken != "" {
+			opts = append(opts, slack.OptionAppLevelToken(b.AppToken))
+		}
+		api := slack.New(b.BotToken, opts...)
+		b.client = api
+		b.api = api
+		b.roles.Members = func(ctx context.Context, groupID string) ([]string, error) {
+			return api.GetUserGroupMembersContext(ctx, groupID)
+		}
+	})
+	return b.client
+}
+
+// SetAllowedUser changes the user whose replies are forwarded.
+// It is safe to call while the bot is running.
+func (b *Bot) SetAllowedUser(user string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.AllowedUser = user
+}
+
+// SetTeam changes the team directory. It is safe to call while the bot is running.
+func (b *Bot) SetTeam(d team.Directory) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Team = d
+}
+
+// SetAccess changes the access control list. It is safe to call while the
+// bot is running.
+func (b *Bot) SetAccess(acl access.ACL) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Access = acl
+}
+
+// SetReactions changes the reactions that answer permission prompts.
+// It is safe to call while the bot is running.
+func (b *Bot) SetReactions(r reaction.Map) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Reactions = r
+}
+
+// SetRedactor changes how secrets are masked in terminal captures.
+// It is safe to call while the bot is running.
+func (b *Bot) SetRedactor(r *redact.Redactor) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Redactor = r
+}
+
+// role returns what user may do in a thread owned by owner.
+// The owner, their delegates and AllowedUser are operators; everyone else
+// gets the role granted by Access. Without any of these configured, every
+// user is an operator.
+func (b *Bot) role(ctx context.Context, user, owner string) access.Role {
+	b.mu.RLock()
+	allowed, directory, acl := b.AllowedUser, b.Team, b.Access
+	b.mu.RUnlock()
+
+	m, owned := directory.Lookup(owner)
+	switch {
+	case owned && m.CanReply(user):
+		return access.Operator
+	case owned:
+	case allowed != "" && user == allowed:
+		return access.Operator
+	case allowed == "" && len(directory) == 0 && acl.Empty():
+		return access.Operator
+	}
+	return b.roles.Role(ctx, acl, user)
+}
+
+// authorize reports whether user may send text to thread. If not, the
+// returned reason explains why.
+func (b *Bot) authorize(ctx context.Context, user string, thread server.Thread, text string) (ok bool, reason string) {
+	isAnswer := false
+	name, _, command := parseCommand(text)
+	if !command && thread.Pending != nil {
+		_, err := answer.Parse(prompt(thread.Pending), text)
+		isAnswer = err == nil
+	}
+	role := b.role(ctx, user, thread.Owner)
+	switch {
+	case role >= access.Operator, isAnswer && role >= access.Approver, viewCommands[name] && role >= access.Viewer:
+		return true, ""
+	case role == access.Approver && thread.Pending != nil:
+		return false, "Approvers can only answer permission prompts, by replying with an option number or label. Your message was not sent."
+	case role == access.Approver:
+		return false, "Approvers can only answer permission prompts, and this session is not waiting for one. Your message was not sent."
+	case role == access.Viewer:
+		return false, "You can view this session but not act on it. Your message was not sent."
+	default:
+		return false, "You don't have access to this session. Your message was not sent."
+	}
+}
+
+// reject tells user privately why their message was not forwarded.
+func (b *Bot) reject(user, channel, threadTS, reason string) {
+	if b.api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := b.api.PostEphemeralContext(ctx, channel, user, slack.MsgOptionText(reason, false), slack.MsgOptionTS(threadTS)); err != nil {
+		logger().Warn("failed to post ephemeral message", logging.User, user, logging.Channel, channel, logging.ThreadTS, threadTS, "error", err)
+	}
 }
 
 // Run starts the Socket Mode connection and blocks until ctx is cancelled.
 func (b *Bot) Run(ctx context.Context) error {
-	api := slack.New(b.BotToken, slack.OptionAppLevelToken(b.AppToken))
-	client := socketmode.New(api)
+	client := socketmode.New(b.slackClient())
 	handler := socketmode.NewSocketmodeHandler(client)
 
-	handler.HandleEvents(slackevents.AppMention, func(evt *socketmode.Event, c *socketmode.Client) {
+	onEvent := func(evt *socketmode.Event, c *socketmode.Client) {
 		c.Ack(*evt.Request)
-		b.handleAppMention(evt)
+		eventsAPI, ok := evt.Data.(slackevents.EventsAPIEvent)
+		if !ok {
+			logger().Warn("failed to cast EventsAPIEvent")
+			return
+		}
+		b.handleEvent(eventsAPI)
+	}
+	handler.HandleEvents(slackevents.AppMention, onEvent)
+	handler.HandleEvents(slackevents.Message, onEvent)
+	handler.HandleEvents(slackevents.ReactionAdded, onEvent)
+
+	for _, et := range []socketmode.EventType{
+		socketmode.EventTypeConnecting,
+		socketmode.EventTypeConnected,
+		socketmode.EventTypeConnectionError,
+		socketmode.EventTypeInvalidAuth,
+	} {
+		handler.Handle(et, func(evt *socketmode.Event, c *socketmode.Client) {
+			logger().Info("socket mode state changed", "state", evt.Type)
+			b.setSocketState(string(evt.Type))
+		})
+	}
+	handler.Handle(socketmode.EventTypeDisconnect, func(evt *socketmode.Event, c *socketmode.Client) {
+		b.setSocketState("disconnected")
 	})
 
-	handler.HandleEvents(slackevents.Message, func(evt *socketmode.Event, c *socketmode.Client) {
+	handler.Handle(socketmode.EventTypeInteractive, func(evt *socketmode.Event, c *socketmode.Client) {
 		c.Ack(*evt.Request)
-		b.handleMessage(evt)
+		callback, ok := evt.Data.(slack.InteractionCallback)
+		if !ok {
+			logger().Warn("failed to cast InteractionCallback")
+			return
+		}
+		b.handleInteraction(callback)
 	})
 
 	return handler.RunEventLoopContext(ctx)
 }
 
-func (b *Bot) handleAppMention(evt *socketmode.Event) {
-	eventsAPI, ok := evt.Data.(slackevents.EventsAPIEvent)
+// handleEvent forwards thread replies from an Events API event, whether it
+// arrived over Socket Mode or HTTP.
+func (b *Bot) handleEvent(e slackevents.EventsAPIEvent) {
+	switch ev := e.InnerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		logger().Info("app_mention", logging.User, ev.User, logging.Channel, ev.Channel, logging.ThreadTS, ev.ThreadTimeStamp, logging.Body("text", ev.Text))
+		b.forwardToTmux(ev.User, ev.Channel, ev.ThreadTimeStamp, ev.Text)
+	case *slackevents.MessageEvent:
+		// Ignore bot messages to avoid loops.
+		if ev.BotID != "" || ev.SubType != "" {
+			return
+		}
+		logger().Info("message", logging.User, ev.User, logging.Channel, ev.Channel, logging.ThreadTS, ev.ThreadTimeStamp, logging.Body("text", ev.Text))
+		b.forwardToTmux(ev.User, ev.Channel, ev.ThreadTimeStamp, ev.Text)
+	case *slackevents.ReactionAddedEvent:
+		if ev.Item.Type != "message" {
+			return
+		}
+		logger().Info("reaction_added", logging.User, ev.User, logging.Channel, ev.Item.Channel, "ts", ev.Item.Timestamp, "reaction", ev.Reaction)
+		b.answerReaction(ev.User, ev.Item.Channel, ev.Item.Timestamp, ev.Reaction)
+	}
+}
+
+// answerReaction answers the pending permission prompt posted as the
+// message ts with the option the reaction maps to. Reactions from users
+// who may not answer are ignored without a reply, since reacting is not
+// necessarily meant as an answer.
+func (b *Bot) answerReaction(user, channel, ts, reaction string) {
+	thread, ok := b.Threads.GetByPromptTS(channel, ts)
 	if !ok {
-		log.Printf("[bot] failed to cast EventsAPIEvent")
+		// Most reactions are on other messages and are not meant as answers.
+		logger().Debug("skipped: reaction is not on a pending prompt", logging.Channel, channel, "ts", ts)
 		return
 	}
-
-	mention, ok := eventsAPI.InnerEvent.Data.(*slackevents.AppMentionEvent)
+	b.mu.RLock()
+	reactions := b.Reactions
+	b.mu.RUnlock()
+	option, ok := reactions.Choice(reaction, thread.Pending.Options)
 	if !ok {
-		log.Printf("[bot] failed to cast AppMentionEvent")
+		logger().Debug("skipped: reaction does not choose an option", logging.ThreadTS, thread.ThreadTS, "reaction", reaction)
+		metrics.Skipped("unknown_reaction")
 		return
 	}
+	answer := strconv.Itoa(option)
 
-	log.Printf("[bot] app_mention: user=%s thread_ts=%s text=%q", mention.User, mention.ThreadTimeStamp, mention.Text)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	allowed, reason := b.authorize(ctx, user, thread, answer)
+	cancel()
+	if !allowed {
+		logger().Info("ignored reaction", logging.User, user, "owner", thread.Owner, logging.ThreadTS, thread.ThreadTS, "reason", reason)
+		metrics.Skipped("not_allowed")
+		return
+	}
+	b.forwardToTmux(user, channel, thread.ThreadTS, answer)
+}
 
-	b.forwardToTmux(mention.User, mention.ThreadTimeStamp, mention.Text)
+// handleInteraction handles clicks on the answer buttons of a prompt,
+// which are forwarded like a reply with the option number.
+func (b *Bot) handleInteraction(callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		logger().Info("ignored interaction", "type", callback.Type, logging.User, callback.User.ID)
+		return
+	}
+	channel := callback.Channel.ID
+	// The prompt is either the thread's parent or a reply in it.
+	threadTS := cmp.Or(callback.Message.ThreadTimestamp, callback.Message.Timestamp)
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.BlockID != render.AnswerBlock {
+			continue
+		}
+		logger().Info("answer button", logging.User, callback.User.ID, logging.Channel, channel, logging.ThreadTS, threadTS, "option", action.Value)
+		if thread, ok := b.Threads.GetByThreadTS(channel, threadTS); ok && thread.Pending == nil {
+			metrics.Skipped("not_pending")
+			b.reject(callback.User.ID, channel, threadTS, "This prompt was already answered. Your choice was not sent.")
+			continue
+		}
+		b.forwardToTmux(callback.User.ID, channel, threadTS, action.Value)
+	}
 }
 
-func (b *Bot) handleMessage(evt *socketmode.Event) {
-	eventsAPI, ok := evt.Data.(slackevents.EventsAPIEvent)
-	if !ok {
-		log.Printf("[bot] failed to cast EventsAPIEvent")
+func (b *Bot) forwardToTmux(user, channel, threadTS, text string) {
+	// Only handle messages in threads that we created.
+	if threadTS == "" {
+		logger().Debug("skipped: not in a thread", logging.User, user, logging.Channel, channel)
+		metrics.Skipped("not_in_thread")
 		return
 	}
 
-	msg, ok := eventsAPI.InnerEvent.Data.(*slackevents.MessageEvent)
+	thread, ok := b.Threads.GetByThreadTS(channel, threadTS)
 	if !ok {
-		log.Printf("[bot] failed to cast MessageEvent")
+		logger().Info("skipped: thread not found in store", logging.Channel, channel, logging.ThreadTS, threadTS)
+		metrics.Skipped("unknown_thread")
 		return
 	}
-
-	// Ignore bot messages to avoid loops.
-	if msg.BotID != "" || msg.SubType != "" {
+	if thread.TmuxTarget == "" {
+		logger().Info("skipped: tmux target is empty", logging.Channel, channel, logging.ThreadTS, threadTS)
+		metrics.Skipped("no_tmux_target")
 		return
 	}
 
-	log.Printf("[bot] message: user=%s thread_ts=%s text=%q", msg.User, msg.ThreadTimeStamp, msg.Text)
-
-	b.forwardToTmux(msg.User, msg.ThreadTimeStamp, msg.Text)
-}
+	text = StripMention(text)
+	if text == "" {
+		logger().Info("skipped: text is empty after stripping mention", logging.ThreadTS, threadTS)
+		metrics.Skipped("empty_text")
+		return
+	}
 
-func (b *Bot) forwardToTmux(user, threadTS, text string) {
-	// Only handle messages in threads that we created.
-	if threadTS == "" {
-		log.Printf("[bot] skipped: not in a thread")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	allowed, reason := b.authorize(ctx, user, thread, text)
+	cancel()
+	if !allowed {
+		logger().Info("rejected", logging.User, user, "owner", thread.Owner, logging.ThreadTS, threadTS, "reason", reason)
+		metrics.Skipped("not_allowed")
+		b.reject(user, channel, threadTS, reason)
 		return
 	}
 
-	tmuxTarget, ok := b.Threads.GetByThreadTS(threadTS)
-	if !ok {
-		log.Printf("[bot] skipped: thread_ts=%s not found in store", threadTS)
+	if name, args, ok := parseCommand(text); ok {
+		b.runCommand(user, channel, thread, name, args)
 		return
 	}
-	if tmuxTarget == "" {
-		log.Printf("[bot] skipped: tmux target is empty for thread_ts=%s", threadTS)
+	if thread.Pending != nil {
+		b.answerPrompt(user, channel, thread, text)
 		return
 	}
 
-	// Only allow messages from the configured user.
-	if b.AllowedUser != "" && user != b.AllowedUser {
-		log.Printf("[bot] skipped: user %s not allowed (allowed=%s)", user, b.AllowedUser)
+	logger().Info("sending to tmux", logging.TmuxTarget, thread.TmuxTarget, logging.ThreadTS, threadTS, logging.Body("text", text))
+	if err := tmux.SendKeys(thread.TmuxTarget, text); err != nil {
+		logger().Error("tmux send-keys failed", logging.TmuxTarget, thread.TmuxTarget, "error", err)
+		metrics.Skipped("send_failed")
 		return
 	}
+	metrics.Forwarded()
+}
 
-	text = StripMention(text)
-	if text == "" {
-		log.Printf("[bot] skipped: text is empty after stripping mention")
+// answerPrompt answers the prompt pending in thread with the keystrokes text
+// translates to. Text that does not answer it is not sent, since the
+// prompt would swallow it.
+func (b *Bot) answerPrompt(user, channel string, thread server.Thread, text string) {
+	a, err := answer.Parse(prompt(thread.Pending), text)
+	if err != nil {
+		logger().Info("skipped: reply does not answer the prompt", logging.User, user, logging.ThreadTS, thread.ThreadTS, "error", err)
+		metrics.Skipped("invalid_answer")
+		b.reject(user, channel, thread.ThreadTS, "The session is waiting on a prompt: "+err.Error()+". Your message was not sent.")
 		return
 	}
 
-	log.Printf("[bot] sending to tmux target=%s text=%q", tmuxTarget, text)
-	if err := tmux.SendKeys(tmuxTarget, text); err != nil {
-		log.Printf("[bot] tmux send-keys failed: %v", err)
+	// The keys may include typed text, so only their number is logged.
+	logger().Info("answering prompt", logging.TmuxTarget, thread.TmuxTarget, logging.ThreadTS, thread.ThreadTS, "tool", thread.Pending.Tool,
+		"keys", len(a.Keys), logging.Body("answer", a.Summary))
+	if err := tmux.Send(thread.TmuxTarget, a.Keys...); err != nil {
+		logger().Error("tmux send-keys failed", logging.TmuxTarget, thread.TmuxTarget, "error", err)
+		metrics.Skipped("send_failed")
+		return
+	}
+	metrics.Forwarded()
+	if b.Prompts != nil {
+		b.Prompts.ResolvePrompt(channel, thread.ThreadTS, user, a.Summary)
 	}
 }
 
+// prompt describes p for parsing answers to it.
+func prompt(p *server.Prompt) answer.Prompt {
+	return answer.Prompt{Tool: p.Tool, Options: p.Options, Questions: p.Questions}
+}
+
+// logger returns the logger for bot messages.
+func logger() *slog.Logger {
+	return slog.Default().With("component", "bot")
+}
+
 // StripMention removes the leading <@BOTID> mention from a message.
 func StripMention(text string) string {
 	return mentionRe.ReplaceAllString(text, "")
@@ -1,6 +1,14 @@
 package bot
 
-import "testing"
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nktks/cc-slack/internal/access"
+	"github.com/nktks/cc-slack/internal/server"
+	"github.com/nktks/cc-slack/internal/team"
+)
 
 func TestStripMention(t *testing.T) {
 	tests := []struct {
@@ -23,3 +31,184 @@ func TestStripMention(t *testing.T) {
 		})
 	}
 }
+
+func TestRole(t *testing.T) {
+	directory := team.Directory{
+		"alice": {SlackID: "U111", Delegates: []string{"U222"}},
+	}
+	acl := access.ACL{
+		Users:  map[string]access.Role{"U333": access.Approver, "U444": access.Viewer},
+		Groups: map[string]access.Role{"S1": access.Operator},
+	}
+	members := func(ctx context.Context, groupID string) ([]string, error) {
+		return []string{"U555"}, nil
+	}
+	tests := []struct {
+		name    string
+		allowed string
+		team    team.Directory
+		acl     access.ACL
+		user    string
+		owner   string
+		want    access.Role
+	}{
+		{"single user mode allows the allowed user", "U111", nil, access.ACL{}, "U111", "", access.Operator},
+		{"single user mode rejects others", "U111", nil, access.ACL{}, "U999", "", access.None},
+		{"no restriction without allowed user", "", nil, access.ACL{}, "U999", "", access.Operator},
+		{"owner may reply", "", directory, access.ACL{}, "U111", "alice", access.Operator},
+		{"delegate may reply", "", directory, access.ACL{}, "U222", "alice", access.Operator},
+		{"others may not reply to owned session", "U999", directory, access.ACL{}, "U999", "alice", access.None},
+		{"unknown owner falls back to allowed user", "U999", directory, access.ACL{}, "U999", "bob", access.Operator},
+		{"team mode without allowed user rejects unowned", "", directory, access.ACL{}, "U111", "", access.None},
+		{"acl restricts everyone without allowed user", "", nil, acl, "U999", "", access.None},
+		{"acl user role", "", nil, acl, "U333", "", access.Approver},
+		{"acl viewer", "", nil, acl, "U444", "", access.Viewer},
+		{"acl group role", "", nil, acl, "U555", "", access.Operator},
+		{"acl applies to owned sessions", "", directory, acl, "U333", "alice", access.Approver},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bot{AllowedUser: tt.allowed, Team: tt.team, Access: tt.acl}
+			b.roles.Members = members
+			if got := b.role(context.Background(), tt.user, tt.owner); got != tt.want {
+				t.Errorf("role(%q, %q) = %v, want %v", tt.user, tt.owner, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	b := &Bot{Access: access.ACL{Users: map[string]access.Role{
+		"U1": access.Operator,
+		"U2": access.Approver,
+		"U3": access.Viewer,
+	}}}
+	pending := server.Thread{Pending: &server.Prompt{Tool: "Bash", Options: []string{"Yes", "Yes, and don't ask again for this session", "No"}}}
+	question := server.Thread{Pending: &server.Prompt{Tool: "AskUserQuestion", Options: []string{"Postgres", "SQLite"}}}
+	idle := server.Thread{}
+	tests := []struct {
+		name   string
+		user   string
+		thread server.Thread
+		text   string
+		want   bool
+	}{
+		{"operator sends prompt", "U1", idle, "run the tests", true},
+		{"operator answers prompt", "U1", pending, "1", true},
+		{"approver answers prompt", "U2", pending, " 2 ", true},
+		{"approver answers prompt with label", "U2", pending, "no", true},
+		{"approver cannot pick a missing option", "U2", pending, "4", false},
+		{"approver cannot send commands", "U2", question, "!esc", false},
+		{"operator sends commands", "U1", idle, "!interrupt", true},
+		{"viewer sees the screen", "U3", idle, "!screen", true},
+		{"viewer cannot send keys", "U3", idle, "!keys Enter", false},
+		{"approver cannot send prompt", "U2", pending, "run the tests", false},
+		{"approver cannot answer without pending prompt", "U2", idle, "1", false},
+		{"viewer cannot answer prompt", "U3", pending, "1", false},
+		{"unknown user is rejected", "U9", pending, "1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, reason := b.authorize(context.Background(), tt.user, tt.thread, tt.text)
+			if ok != tt.want {
+				t.Errorf("authorize(%q, %q) = %v, want %v", tt.user, tt.text, ok, tt.want)
+			}
+			if !ok && reason == "" {
+				t.Error("rejection should have a reason")
+			}
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantName string
+		wantArgs string
+		wantOK   bool
+	}{
+		{"!esc", "esc", "", true},
+		{"  !keys Down  Enter ", "keys", "Down Enter", true},
+		{"!ls -la", "", "", false},
+		{"please run !interrupt", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseCommand(tt.text)
+		if name != tt.wantName || strings.Join(args, " ") != tt.wantArgs || ok != tt.wantOK {
+			t.Errorf("parseCommand(%q) = %q, %q, %v, want %q, %q, %v", tt.text, name, args, ok, tt.wantName, tt.wantArgs, tt.wantOK)
+		}
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{"esc", nil, "Escape", ""},
+		{"interrupt", nil, "C-c", ""},
+		{"mode", nil, "BTab", ""},
+		{"keys", []string{"Down", "Down", "Enter"}, "Down Down Enter", ""},
+		{"keys", []string{"C-M-x", "y", "F12"}, "C-M-x y F12", ""},
+		{"keys", nil, "", "usage"},
+		{"keys", []string{"Down", "rm -rf"}, "", `unknown key "rm -rf"`},
+		{"esc", []string{"now"}, "", "takes no arguments"},
+	}
+	for _, tt := range tests {
+		keys, err := commandKeys(tt.name, tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("commandKeys(%s, %q) error = %v, want %q", tt.name, tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		var got []string
+		for _, k := range keys {
+			got = append(got, k.String())
+		}
+		if err != nil || strings.Join(got, " ") != tt.want {
+			t.Errorf("commandKeys(%s, %q) = %q, %v, want %q", tt.name, tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestScreenText(t *testing.T) {
+	capture := "\n$ go test\n--- FAIL: TestX <nil> & ```\n\nFAIL\n\n"
+	want := "```\n$ go test\n--- FAIL: TestX &lt;nil&gt; &amp; `​`​`\n\nFAIL\n```"
+	if got := screenText(capture, 10); got != want {
+		t.Errorf("screenText() = %q, want %q", got, want)
+	}
+	if got := screenText("a\nb\nc", 1); got != "```\nc\n```" {
+		t.Errorf("screenText(1) = %q", got)
+	}
+	if got := screenText("\n \n", 10); !strings.Contains(got, "empty") {
+		t.Errorf("screenText(blank) = %q", got)
+	}
+	markup := strings.Repeat(strings.Repeat("<", 200)+"\n", 200)
+	if got := screenText(markup, 200); len(got) > 40000 {
+		t.Errorf("screenText(markup) has %d characters, want at most 40000", len(got))
+	}
+}
+
+func TestScreenLines(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    int
+		wantErr bool
+	}{
+		{nil, defaultScreenLines, false},
+		{[]string{"80"}, 80, false},
+		{[]string{"0"}, 0, true},
+		{[]string{"1000"}, 0, true},
+		{[]string{"10", "20"}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := screenLines(tt.args)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("screenLines(%q) = %d, %v, want %d (error %v)", tt.args, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/logging"
+	"github.com/nktks/cc-slack/internal/metrics"
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/screen"
+	"github.com/nktks/cc-slack/internal/server"
+	"github.com/nktks/cc-slack/internal/tmux"
+	"github.com/slack-go/slack"
+)
+
+// keyCommands are the thread commands that press a single key, mapped to
+// its tmux name. Together with !keys and viewCommands, they control the session
+// instead of being sent as text. Other messages starting with "!", such as
+// Claude Code's bash mode, are sent as usual.
+var keyCommands = map[string]string{
+	"esc":       "Escape",
+	"interrupt": "C-c",
+	"mode":      "BTab",
+}
+
+// viewCommands only show the session, so viewers may run them.
+var viewCommands = map[string]bool{
+	"screen":     true,
+	"screenshot": true,
+}
+
+const (
+	// defaultScreenLines is how many lines !screen shows by default.
+	defaultScreenLines = 40
+	// maxScreenLines bounds the lines !screen shows.
+	maxScreenLines = 200
+	// maxScreenText keeps a capture well below Slack's message size limit.
+	maxScreenText = 35000
+)
+
+// keyRe matches the tmux key names accepted by !keys: a special key or a
+// single character, optionally with Ctrl, Meta or Shift modifiers.
+var keyRe = regexp.MustCompile(`^([CMS]-)*(Enter|Escape|Tab|BTab|Space|BSpace|Up|Down|Left|Right|Home|End|PageUp|PageDown|PPage|NPage|IC|DC|F([1-9]|1[0-2])|[[:graph:]])$`)
+
+// maxKeys bounds the keys one !keys command sends.
+const maxKeys = 50
+
+// parseCommand splits text into a command name and its arguments, if it
+// is a command.
+func parseCommand(text string) (name string, args []string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "!") {
+		return "", nil, false
+	}
+	name = strings.TrimPrefix(fields[0], "!")
+	if _, ok := keyCommands[name]; !ok && name != "keys" && !viewCommands[name] {
+		return "", nil, false
+	}
+	return name, fields[1:], true
+}
+
+// commandKeys returns the keys command name sends.
+func commandKeys(name string, args []string) ([]tmux.Key, error) {
+	if name != "keys" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("!%s takes no arguments", name)
+		}
+		return []tmux.Key{tmux.Named(keyCommands[name])}, nil
+	}
+	if len(args) == 0 {
+		return nil, errors.New("usage: !keys Down Down Enter")
+	}
+	if len(args) > maxKeys {
+		return nil, fmt.Errorf("!keys sends at most %d keys", maxKeys)
+	}
+	var keys []tmux.Key
+	for _, a := range args {
+		if !keyRe.MatchString(a) {
+			return nil, fmt.Errorf("unknown key %q", a)
+		}
+		keys = append(keys, tmux.Named(a))
+	}
+	return keys, nil
+}
+
+// runCommand runs command name in thread on behalf of user, and
+// acknowledges it in the thread.
+func (b *Bot) runCommand(user, channel string, thread server.Thread, name string, args []string) {
+	switch name {
+	case "screen":
+		b.postScreen(user, channel, thread, args)
+		return
+	case "screenshot":
+		b.postScreenshot(user, channel, thread, args)
+		return
+	}
+	keys, err := commandKeys(name, args)
+	if err != nil {
+		logger().Info("skipped: invalid command", logging.User, user, logging.ThreadTS, thread.ThreadTS, "command", name, "error", err)
+		metrics.Skipped("invalid_command")
+		b.reject(user, channel, thread.ThreadTS, "Invalid command: "+err.Error()+". Nothing was sent.")
+		return
+	}
+
+	logger().Info("sending keys to tmux", logging.TmuxTarget, thread.TmuxTarget, logging.ThreadTS, thread.ThreadTS, "command", name, "keys", keys)
+	if err := tmux.Send(thread.TmuxTarget, keys...); err != nil {
+		logger().Error("tmux send-keys failed", logging.TmuxTarget, thread.TmuxTarget, "error", err)
+		metrics.Skipped("send_failed")
+		b.reply(channel, thread.ThreadTS, fmt.Sprintf(":warning: `!%s` failed: %v", name, err))
+		return
+	}
+	metrics.Forwarded()
+
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.String()
+	}
+	b.reply(channel, thread.ThreadTS, fmt.Sprintf(":keyboard: <@%s> sent %s", user, "`"+strings.Join(names, " ")+"`"))
+}
+
+// reply posts text to a thread.
+func (b *Bot) reply(channel, threadTS, text string) {
+	if b.api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, _, err := b.api.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTS)); err != nil {
+		logger().Warn("failed to post reply", logging.Channel, channel, logging.ThreadTS, threadTS, "error", err)
+	}
+}
+
+// screenLines parses the arguments of !screen: an optional line count.
+func screenLines(args []string) (int, error) {
+	switch len(args) {
+	case 0:
+		return defaultScreenLines, nil
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > maxScreenLines {
+			return 0, fmt.Errorf("the number of lines must be from 1 to %d", maxScreenLines)
+		}
+		return n, nil
+	}
+	return 0, errors.New("usage: !screen [lines]")
+}
+
+// postScreen posts the last lines of the session's terminal to the thread,
+// with secrets redacted.
+func (b *Bot) postScreen(user, channel string, thread server.Thread, args []string) {
+	n, err := screenLines(args)
+	if err != nil {
+		metrics.Skipped("invalid_command")
+		b.reject(user, channel, thread.ThreadTS, "Invalid command: "+err.Error()+".")
+		return
+	}
+	// Wrapped lines are joined so that a secret split across them is
+	// still found.
+	out, err := tmux.CapturePane(thread.TmuxTarget, tmux.CaptureOptions{History: n, Join: true})
+	if err != nil {
+		logger().Error("tmux capture-pane failed", logging.TmuxTarget, thread.TmuxTarget, "error", err)
+		b.reply(channel, thread.ThreadTS, fmt.Sprintf(":warning: `!screen` failed: %v", err))
+		return
+	}
+	logger().Info("posting screen", logging.User, user, logging.TmuxTarget, thread.TmuxTarget, logging.ThreadTS, thread.ThreadTS, "lines", n)
+	b.reply(channel, thread.ThreadTS, screenText(b.redactor().String(screen.Strip(out)), n))
+}
+
+// postScreenshot uploads an image of the session's terminal to the
+// thread, with secrets redacted.
+func (b *Bot) postScreenshot(user, channel string, thread server.Thread, args []string) {
+	if len(args) > 0 {
+		metrics.Skipped("invalid_command")
+		b.reject(user, channel, thread.ThreadTS, "Invalid command: !screenshot takes no arguments.")
+		return
+	}
+	img, err := screen.Screenshot(thread.TmuxTarget, b.redactor())
+	if err != nil {
+		logger().Error("screenshot failed", logging.TmuxTarget, thread.TmuxTarget, "error", err)
+		b.reply(channel, thread.ThreadTS, fmt.Sprintf(":warning: `!screenshot` failed: %v", err))
+		return
+	}
+	logger().Info("posting screenshot", logging.User, user, logging.TmuxTarget, thread.TmuxTarget, logging.ThreadTS, thread.ThreadTS, "bytes", len(img))
+	if b.api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = b.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Reader:          bytes.NewReader(img),
+		FileSize:        len(img),
+		Filename:        "screen.png",
+		Title:           "Terminal screen",
+		Channel:         channel,
+		ThreadTimestamp: thread.ThreadTS,
+	})
+	if err != nil {
+		logger().Warn("failed to upload screenshot", logging.Channel, channel, logging.ThreadTS, thread.ThreadTS, "error", err)
+		b.reply(channel, thread.ThreadTS, fmt.Sprintf(":warning: `!screenshot` failed: %v", err))
+	}
+}
+
+// redactor returns the Redactor masking secrets in captures.
+func (b *Bot) redactor() *redact.Redactor {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.Redactor == nil {
+		return redact.Default
+	}
+	return b.Redactor
+}
+
+// screenText formats the last n lines of a capture as a code block.
+func screenText(capture string, n int) string {
+	lines := screen.Tail(capture, n)
+	if len(lines) == 0 {
+		return "_The screen is empty._"
+	}
+	// Fences inside the capture would end the block early.
+	escape := strings.NewReplacer("```", "`\u200b`\u200b`", "&", "&amp;", "<", "&lt;", ">", "&gt;")
+	for i, l := range lines {
+		lines[i] = escape.Replace(l)
+	}
+	// Escaping lengthens the text, so the limit applies after it.
+	text := strings.Join(lines, "\n")
+	for len(text) > maxScreenText && len(lines) > 1 {
+		lines = lines[1:]
+		text = strings.Join(lines, "\n")
+	}
+	return "```\n" + text + "\n```"
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/metrics"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// maxBodySize limits the size of Slack request bodies.
+const maxBodySize = 1 << 20
+
+// eventTTL is how long delivered event IDs are remembered. Slack retries
+// a delivery at most three times within about five minutes.
+const eventTTL = 10 * time.Minute
+
+// HandleEvents serves the Events API request URL. Requests are verified
+// with SigningSecret, answered immediately and processed in the background
+// in the order they arrive.
+func (b *Bot) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	body, ok := b.verify(w, r)
+	if !ok {
+		return
+	}
+
+	e, err := slackevents.ParseEvent(body, slackevents.OptionNoVerifyToken())
+	if err != nil {
+		logger().Warn("failed to parse event", "error", err)
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	switch e.Type {
+	case slackevents.URLVerification:
+		challenge, ok := e.Data.(*slackevents.EventsAPIURLVerificationEvent)
+		if !ok {
+			http.Error(w, "invalid challenge", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, challenge.Challenge)
+	case slackevents.CallbackEvent:
+		callback, ok := e.Data.(*slackevents.EventsAPICallbackEvent)
+		if !ok {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if !b.events.First(callback.EventID) {
+			logger().Info("skipped: duplicate delivery", "event_id", callback.EventID,
+				"retry", r.Header.Get("X-Slack-Retry-Num"), "retry_reason", r.Header.Get("X-Slack-Retry-Reason"))
+			metrics.Skipped("duplicate")
+			return
+		}
+		b.slackClient()
+		b.serial.Go(func() { b.handleEvent(e) })
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// HandleInteractivity serves the interactivity request URL.
+func (b *Bot) HandleInteractivity(w http.ResponseWriter, r *http.Request) {
+	body, ok := b.verify(w, r)
+	if !ok {
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+		logger().Warn("failed to parse interaction payload", "error", err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	b.slackClient()
+	b.serial.Go(func() { b.handleInteraction(callback) })
+}
+
+// verify reads the request body and checks its Slack signature. On failure
+// it writes the error response and returns false.
+func (b *Bot) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	sv, err := slack.NewSecretsVerifier(r.Header, b.SigningSecret)
+	if err == nil {
+		sv.Write(body)
+		err = sv.Ensure()
+	}
+	if err != nil {
+		logger().Warn("rejected unsigned request", "path", r.URL.Path, "error", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+	return body, true
+}
+
+// serial runs funcs one at a time in the order they are added, without
+// blocking the caller. The zero value is ready to use.
+type serial struct {
+	mu      sync.Mutex
+	pending []func()
+	running bool
+}
+
+// Go queues f to run after the funcs added before it.
+func (s *serial) Go(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, f)
+	if !s.running {
+		s.running = true
+		go s.run()
+	}
+}
+
+func (s *serial) run() {
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		f := s.pending[0]
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+		f()
+	}
+}
+
+// eventLog remembers recently delivered event IDs so Slack's retries are
+// not forwarded twice.
+type eventLog struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// First reports whether id is seen for the first time within eventTTL.
+func (l *eventLog) First(id string) bool {
+	if id == "" {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range l.seen {
+		if now.Sub(t) > eventTTL {
+			delete(l.seen, k)
+		}
+	}
+	if _, ok := l.seen[id]; ok {
+		return false
+	}
+	if l.seen == nil {
+		l.seen = make(map[string]time.Time)
+	}
+	l.seen[id] = now
+	return true
+}
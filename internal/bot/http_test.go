@@ -0,0 +1,213 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/server"
+)
+
+const testSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// lookupRecorder records the threads the bot looks up.
+type lookupRecorder chan string
+
+func (l lookupRecorder) GetByThreadTS(channel, threadTS string) (server.Thread, bool) {
+	l <- threadTS
+	return server.Thread{}, false
+}
+
+func (l lookupRecorder) GetByPromptTS(channel, ts string) (server.Thread, bool) {
+	l <- ts
+	return server.Thread{}, false
+}
+
+func signedRequest(t *testing.T, path, body string, ts time.Time) *http.Request {
+	t.Helper()
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestHandleEvents(t *testing.T) {
+	t.Run("answers url verification", func(t *testing.T) {
+		b := &Bot{SigningSecret: testSecret}
+		body := `{"type":"url_verification","token":"x","challenge":"abc123"}`
+		w := httptest.NewRecorder()
+		b.HandleEvents(w, signedRequest(t, "/slack/events", body, time.Now()))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if w.Body.String() != "abc123" {
+			t.Errorf("body = %q, want %q", w.Body.String(), "abc123")
+		}
+	})
+
+	t.Run("rejects bad signature", func(t *testing.T) {
+		b := &Bot{SigningSecret: "other"}
+		body := `{"type":"url_verification","challenge":"abc123"}`
+		w := httptest.NewRecorder()
+		b.HandleEvents(w, signedRequest(t, "/slack/events", body, time.Now()))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("rejects old timestamp", func(t *testing.T) {
+		b := &Bot{SigningSecret: testSecret}
+		body := `{"type":"url_verification","challenge":"abc123"}`
+		w := httptest.NewRecorder()
+		b.HandleEvents(w, signedRequest(t, "/slack/events", body, time.Now().Add(-time.Hour)))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("forwards event once across retries", func(t *testing.T) {
+		lookups := make(lookupRecorder, 2)
+		b := &Bot{SigningSecret: testSecret, BotToken: "xoxb-test", Threads: lookups}
+		body := `{"type":"event_callback","event_id":"Ev1","event":{"type":"message","user":"U1","channel":"C1","thread_ts":"111.222","text":"hi"}}`
+
+		for i := range 2 {
+			req := signedRequest(t, "/slack/events", body, time.Now())
+			if i > 0 {
+				req.Header.Set("X-Slack-Retry-Num", "1")
+			}
+			w := httptest.NewRecorder()
+			b.HandleEvents(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+		}
+
+		select {
+		case ts := <-lookups:
+			if ts != "111.222" {
+				t.Errorf("thread_ts = %q, want %q", ts, "111.222")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("event was not forwarded")
+		}
+		select {
+		case <-lookups:
+			t.Error("retried event was forwarded twice")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("reaction is looked up by the prompt message", func(t *testing.T) {
+		lookups := make(lookupRecorder, 2)
+		b := &Bot{SigningSecret: testSecret, BotToken: "xoxb-test", Threads: lookups}
+		body := `{"type":"event_callback","event_id":"Ev2","event":{"type":"reaction_added","user":"U1","reaction":"white_check_mark",` +
+			`"item":{"type":"message","channel":"C1","ts":"333.444"}}}`
+		b.HandleEvents(httptest.NewRecorder(), signedRequest(t, "/slack/events", body, time.Now()))
+
+		select {
+		case ts := <-lookups:
+			if ts != "333.444" {
+				t.Errorf("ts = %q, want %q", ts, "333.444")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("reaction was not handled")
+		}
+	})
+}
+
+func TestHandleInteractivity(t *testing.T) {
+	b := &Bot{SigningSecret: testSecret, BotToken: "xoxb-test"}
+	body := url.Values{"payload": {`{"type":"block_actions","user":{"id":"U1"}}`}}.Encode()
+
+	w := httptest.NewRecorder()
+	b.HandleInteractivity(w, signedRequest(t, "/slack/interactivity", body, time.Now()))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	b.HandleInteractivity(w, signedRequest(t, "/slack/interactivity", "payload=not-json", time.Now()))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	t.Run("answer button is forwarded to the prompt's thread", func(t *testing.T) {
+		lookups := make(lookupRecorder, 2)
+		b := &Bot{SigningSecret: testSecret, BotToken: "xoxb-test", Threads: lookups}
+		payload := `{"type":"block_actions","user":{"id":"U1"},"channel":{"id":"C1"},` +
+			`"message":{"ts":"333.444","thread_ts":"111.222"},` +
+			`"actions":[{"type":"button","block_id":"answer","action_id":"answer_1","value":"1"}]}`
+		body := url.Values{"payload": {payload}}.Encode()
+		b.HandleInteractivity(httptest.NewRecorder(), signedRequest(t, "/slack/interactivity", body, time.Now()))
+
+		select {
+		case ts := <-lookups:
+			if ts != "111.222" {
+				t.Errorf("thread_ts = %q, want %q", ts, "111.222")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("answer was not forwarded")
+		}
+	})
+}
+
+func TestEventLog(t *testing.T) {
+	var l eventLog
+	if !l.First("Ev1") {
+		t.Error("first delivery should be new")
+	}
+	if l.First("Ev1") {
+		t.Error("second delivery should be a duplicate")
+	}
+	if !l.First("Ev2") {
+		t.Error("other event should be new")
+	}
+	l.seen["Ev1"] = time.Now().Add(-2 * eventTTL)
+	if !l.First("Ev1") {
+		t.Error("expired event should be new again")
+	}
+}
+
+func TestSerial(t *testing.T) {
+	var (
+		s    serial
+		mu   sync.Mutex
+		got  []int
+		done = make(chan struct{})
+	)
+	for i := range 20 {
+		s.Go(func() {
+			// Earlier funcs take longer, so running them concurrently
+			// would reorder them.
+			time.Sleep(time.Duration(20-i) * time.Millisecond)
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+			if i == 19 {
+				close(done)
+			}
+		})
+	}
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	for i, n := range got {
+		if n != i {
+			t.Fatalf("order = %v, want 0 to 19", got)
+		}
+	}
+}
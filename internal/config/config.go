@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nktks/cc-slack/internal/access"
+	"github.com/nktks/cc-slack/internal/hook"
+	"github.com/nktks/cc-slack/internal/reaction"
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/render"
+	"github.com/nktks/cc-slack/internal/routing"
+	"github.com/nktks/cc-slack/internal/rules"
+	"github.com/nktks/cc-slack/internal/team"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server configuration read from a YAML file.
+type Config struct {
+	// Token is the Slack Bot User OAuth Token (xoxb-...).
+	Token string `yaml:"token"`
+	// AppToken is the Slack App-Level Token (xapp-...) enabling the reply bot.
+	AppToken string `yaml:"app_token"`
+	// SigningSecret enables the reply bot's HTTP Events API endpoints.
+	SigningSecret string `yaml:"signing_secret"`
+	// Channel is the channel ID (C...) or user ID (U...) notifications go to.
+	Channel string `yaml:"channel"`
+	// MentionUser is the user ID mentioned in notifications.
+	MentionUser string `yaml:"mention_user"`
+	// AllowedUser is the user ID whose thread replies the bot forwards.
+	// Defaults to the DM channel user, or MentionUser for channels.
+	AllowedUser string `yaml:"allowed_user"`
+	// Users enables team mode. It maps the identity sent in the
+	// X-Cc-Slack-User header to a Slack user.
+	Users team.Directory `yaml:"users"`
+	// Access grants roles to Slack users and user groups in notification
+	// threads, in addition to AllowedUser and team owners.
+	Access access.ACL `yaml:"access"`
+	// Reactions map emoji reactions on a permission prompt to the option
+	// they choose.
+	Reactions reaction.Map `yaml:"reactions"`
+	// Routes send matching sessions to other channels than Channel.
+	Routes routing.Table `yaml:"routes"`
+	Limits Limits        `yaml:"limits"`
+	// Redact configures how secrets are removed from notifications.
+	Redact redact.Config `yaml:"redact"`
+	// Format is "blocks" (the default) to post notifications as Block Kit
+	// messages, or "text" for plain text.
+	Format string `yaml:"format"`
+	// Screenshots attaches an image of the session's terminal to
+	// permission prompts.
+	Screenshots bool `yaml:"screenshots"`
+	// Templates customize the message text per event and tool.
+	Templates render.Set `yaml:"templates"`
+	Cron      []Job      `yaml:"cron"`
+
+	rules.Set `yaml:",inline"`
+}
+
+// Limits caps the length of notification parts, in runes.
+type Limits struct {
+	Prompt   *int `yaml:"prompt"`
+	Detail   *int `yaml:"detail"`
+	Response *int `yaml:"response"`
+}
+
+// Job is a scheduled task.
+type Job struct {
+	// Name selects the task. Only "ccusage" is supported.
+	Name string `yaml:"job"`
+	// Schedule is a standard 5-field cron expression.
+	Schedule string `yaml:"schedule"`
+	// Channel overrides the notification channel for this job.
+	Channel string `yaml:"channel"`
+}
+
+// Load reads the configuration file at path. Unknown keys are rejected so
+// that typos do not go unnoticed.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes a configuration from YAML.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks the configuration and compiles its rules.
+// All problems are reported together.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Token == "" {
+		errs = append(errs, errors.New("token is required (or set CC_NOTIFY_SLACK_TOKEN)"))
+	}
+	if c.Channel == "" {
+		errs = append(errs, errors.New("channel is required (or set CC_NOTIFY_SLACK_CHANNEL)"))
+	}
+	if c.BotEnabled() && c.BotAllowedUser() == "" && len(c.Users) == 0 && c.Access.Empty() {
+		errs = append(errs, errors.New("mention_user, allowed_user, users or access is required when the reply bot is enabled with a channel (non-DM)"))
+	}
+	for _, u := range []struct{ key, id string }{
+		{"mention_user", c.MentionUser},
+		{"allowed_user", c.AllowedUser},
+	} {
+		if u.id != "" && !strings.HasPrefix(u.id, "U") && !strings.HasPrefix(u.id, "W") {
+			errs = append(errs, fmt.Errorf("%s must be a user ID (U...), got %q", u.key, u.id))
+		}
+	}
+	for _, l := range []struct {
+		key string
+		n   *int
+	}{
+		{"limits.prompt", c.Limits.Prompt},
+		{"limits.detail", c.Limits.Detail},
+		{"limits.response", c.Limits.Response},
+	} {
+		if l.n != nil && *l.n < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", l.key))
+		}
+	}
+	if c.Format != "" && c.Format != "blocks" && c.Format != "text" {
+		errs = append(errs, fmt.Errorf("format must be blocks or text, got %q", c.Format))
+	}
+	for i, j := range c.Cron {
+		if j.Name != "ccusage" {
+			errs = append(errs, fmt.Errorf("cron[%d]: unknown job %q (supported: ccusage)", i, j.Name))
+		}
+		if _, err := cron.ParseStandard(j.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("cron[%d]: invalid schedule %q: %w", i, j.Schedule, err))
+		}
+	}
+	if err := c.Users.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Access.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Reactions.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Routes.Compile(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Templates.Compile(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Redact.Compile(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Set.Compile(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// BotEnabled reports whether the reply bot runs, over Socket Mode or HTTP.
+func (c *Config) BotEnabled() bool {
+	return c.AppToken != "" || c.SigningSecret != ""
+}
+
+// BotAllowedUser returns the user whose replies the bot forwards.
+func (c *Config) BotAllowedUser() string {
+	if c.AllowedUser != "" {
+		return c.AllowedUser
+	}
+	if strings.HasPrefix(c.Channel, "U") {
+		return c.Channel
+	}
+	return c.MentionUser
+}
+
+// MessageLimits returns the configured limits, falling back to
+// hook.DefaultLimits for unset values.
+func (c *Config) MessageLimits() hook.Limits {
+	l := hook.DefaultLimits
+	if c.Limits.Prompt != nil {
+		l.Prompt = *c.Limits.Prompt
+	}
+	if c.Limits.Detail != nil {
+		l.Detail = *c.Limits.Detail
+	}
+	if c.Limits.Response != nil {
+		l.Response = *c.Limits.Response
+	}
+	return l
+}
+
+// BlockKit reports whether notifications are posted as Block Kit messages.
+func (c *Config) BlockKit() bool {
+	return c.Format != "text"
+}
+
+// RuleSet returns the compiled rules, or nil if none are configured.
+// Validate must have been called first.
+func (c *Config) RuleSet() *rules.Set {
+	if len(c.Set.Rules) == 0 {
+		return nil
+	}
+	return &c.Set
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nktks/cc-slack/internal/access"
+	"github.com/nktks/cc-slack/internal/hook"
+	"github.com/nktks/cc-slack/internal/routing"
+	"github.com/nktks/cc-slack/internal/rules"
+)
+
+const sampleConfig = `
+token: xoxb-test
+app_token: xapp-test
+channel: C123
+mention_user: U111
+users:
+  alice:
+    slack_id: U222
+    delegates: [U333]
+access:
+  users:
+    U444: approver
+reactions:
+  rocket: 1
+  x: no
+routes:
+  - cwd: /work/api
+    channel: C_API
+limits:
+  prompt: 50
+  response: 500
+cron:
+  - job: ccusage
+    schedule: "0 9 * * 1"
+rules:
+  - event: PermissionRequest
+    tool: Read
+    action: drop
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(sampleConfig), 0600)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	if cfg.Token != "xoxb-test" || cfg.AppToken != "xapp-test" {
+		t.Errorf("tokens = %q, %q", cfg.Token, cfg.AppToken)
+	}
+	if cfg.Channel != "C123" {
+		t.Errorf("channel = %q, want %q", cfg.Channel, "C123")
+	}
+	if r, ok := cfg.Routes.Match(routing.Request{Cwd: "/work/api/cmd"}); !ok || r.Channel != "C_API" {
+		t.Errorf("route = %q (ok=%v), want %q", r.Channel, ok, "C_API")
+	}
+	if m, ok := cfg.Users.Lookup("alice"); !ok || !m.CanReply("U333") {
+		t.Errorf("users.alice = %+v (ok=%v)", m, ok)
+	}
+	if cfg.Access.Users["U444"] != access.Approver {
+		t.Errorf("access = %+v", cfg.Access)
+	}
+	if cfg.Reactions["rocket"] != "1" || cfg.Reactions["x"] != "no" {
+		t.Errorf("reactions = %+v", cfg.Reactions)
+	}
+	if len(cfg.Cron) != 1 || cfg.Cron[0].Name != "ccusage" {
+		t.Errorf("cron = %+v", cfg.Cron)
+	}
+	if got := cfg.RuleSet().Evaluate(rules.Event{Name: "PermissionRequest", Tool: "Read"}); got != rules.Drop {
+		t.Errorf("rule action = %q, want %q", got, rules.Drop)
+	}
+	want := hook.Limits{Prompt: 50, Detail: hook.DefaultLimits.Detail, Response: 500}
+	if got := cfg.MessageLimits(); got != want {
+		t.Errorf("limits = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	_, err := Parse([]byte("token: x\nchanel: C123\n"))
+	if err == nil || !strings.Contains(err.Error(), "chanel") {
+		t.Errorf("error = %v, want mention of unknown key", err)
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	cfg, err := Parse(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RuleSet() != nil {
+		t.Error("empty config should have no rules")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr []string
+	}{
+		{
+			name:    "missing token and channel",
+			yaml:    "",
+			wantErr: []string{"token is required", "channel is required"},
+		},
+		{
+			name:    "bot in channel without user",
+			yaml:    "token: x\nchannel: C123\napp_token: y\n",
+			wantErr: []string{"mention_user, allowed_user, users or access is required"},
+		},
+		{
+			name:    "http bot in channel without user",
+			yaml:    "token: x\nchannel: C123\nsigning_secret: y\n",
+			wantErr: []string{"mention_user, allowed_user, users or access is required"},
+		},
+		{
+			name:    "bad user ID",
+			yaml:    "token: x\nchannel: C123\nmention_user: alice\n",
+			wantErr: []string{"mention_user must be a user ID"},
+		},
+		{
+			name:    "negative limit",
+			yaml:    "token: x\nchannel: C123\nlimits:\n  detail: -1\n",
+			wantErr: []string{"limits.detail must not be negative"},
+		},
+		{
+			name:    "bad cron",
+			yaml:    "token: x\nchannel: C123\ncron:\n  - job: backup\n    schedule: never\n",
+			wantErr: []string{`unknown job "backup"`, `invalid schedule "never"`},
+		},
+		{
+			name:    "bad team member",
+			yaml:    "token: x\nchannel: C123\nusers:\n  alice:\n    slack_id: alice\n",
+			wantErr: []string{"users.alice: slack_id must be a user ID"},
+		},
+		{
+			name:    "bad access list",
+			yaml:    "token: x\nchannel: C123\naccess:\n  groups:\n    U111: viewer\n",
+			wantErr: []string{`access.groups: "U111" is not a user group ID`},
+		},
+		{
+			name:    "bad reaction",
+			yaml:    "token: x\nchannel: U123\nreactions:\n  x: deny\n",
+			wantErr: []string{`reactions: x: choice must be an option number, last or no, got "deny"`},
+		},
+		{
+			name:    "bad route",
+			yaml:    "token: x\nchannel: C123\nroutes:\n  - cwd: /work\n",
+			wantErr: []string{"route 1: channel is required"},
+		},
+		{
+			name:    "bad rule",
+			yaml:    "token: x\nchannel: C123\nrules:\n  - action: shout\n",
+			wantErr: []string{"action must be notify, silent or drop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			err = cfg.Validate()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBotAllowedUser(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Channel: "C123", MentionUser: "U1", AllowedUser: "U2"}, "U2"},
+		{Config{Channel: "U5555", MentionUser: "U1"}, "U5555"},
+		{Config{Channel: "C123", MentionUser: "U1"}, "U1"},
+		{Config{Channel: "C123"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.BotAllowedUser(); got != tt.want {
+			t.Errorf("BotAllowedUser(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
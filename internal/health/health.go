@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds how long a readiness probe waits for its checks.
+const checkTimeout = 5 * time.Second
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// OK means the component works.
+	OK Status = "ok"
+	// Warn means the component works but needs attention. It does not
+	// make the server unready.
+	Warn Status = "warn"
+	// Fail means the component does not work and the server is not ready.
+	Fail Status = "fail"
+)
+
+// Result is the report of a single check.
+type Result struct {
+	Status  Status         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Check inspects one component.
+type Check func(ctx context.Context) Result
+
+// Report is the body served by the readiness endpoint.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker serves liveness and readiness endpoints.
+// Checks must be added before the endpoints are served.
+type Checker struct {
+	names  []string
+	checks []Check
+}
+
+// Add registers a check under name.
+func (c *Checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.checks = append(c.checks, check)
+}
+
+// Run runs all checks concurrently. The report fails if any check fails.
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: OK, Checks: make(map[string]Result, len(results))}
+	for i, r := range results {
+		report.Checks[c.names[i]] = r
+		if r.Status == Fail {
+			report.Status = Fail
+		}
+	}
+	return report
+}
+
+// HandleLive reports that the process is up and serving HTTP.
+func (c *Checker) HandleLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]Status{"status": OK})
+}
+
+// HandleReady runs the checks and responds 200 when none failed, or 503
+// otherwise. The body is a JSON Report either way.
+func (c *Checker) HandleReady(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	code := http.StatusOK
+	if report.Status == Fail {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Cached wraps check so that it runs at most once per ttl. Probes in
+// between get the previous result, which keeps frequent polling from
+// reaching rate-limited APIs.
+func Cached(check Check, ttl time.Duration) Check {
+	var (
+		mu      sync.Mutex
+		last    Result
+		checked time.Time
+	)
+	return func(ctx context.Context) Result {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			return last
+		}
+		last = check(ctx)
+		checked = time.Now()
+		return last
+	}
+}
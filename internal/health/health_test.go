@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleReady(t *testing.T) {
+	result := func(s Status) Check {
+		return func(ctx context.Context) Result { return Result{Status: s} }
+	}
+	tests := []struct {
+		name   string
+		checks map[string]Status
+		code   int
+		status Status
+	}{
+		{"all ok", map[string]Status{"a": OK, "b": OK}, http.StatusOK, OK},
+		{"warnings keep the server ready", map[string]Status{"a": OK, "b": Warn}, http.StatusOK, OK},
+		{"failure makes the server unready", map[string]Status{"a": Fail, "b": OK}, http.StatusServiceUnavailable, Fail},
+		{"no checks", nil, http.StatusOK, OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Checker
+			for name, s := range tt.checks {
+				c.Add(name, result(s))
+			}
+			w := httptest.NewRecorder()
+			c.HandleReady(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			if w.Code != tt.code {
+				t.Errorf("status code = %d, want %d", w.Code, tt.code)
+			}
+			var report Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if report.Status != tt.status {
+				t.Errorf("status = %q, want %q", report.Status, tt.status)
+			}
+			for name, s := range tt.checks {
+				if report.Checks[name].Status != s {
+					t.Errorf("checks.%s = %q, want %q", name, report.Checks[name].Status, s)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleLive(t *testing.T) {
+	var c Checker
+	c.Add("broken", func(ctx context.Context) Result { return Result{Status: Fail} })
+	w := httptest.NewRecorder()
+	c.HandleLive(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	check := Cached(func(ctx context.Context) Result {
+		calls++
+		return Result{Status: OK}
+	}, time.Hour)
+
+	check(context.Background())
+	check(context.Background())
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+
+	calls = 0
+	check = Cached(func(ctx context.Context) Result {
+		calls++
+		return Result{Status: OK}
+	}, 0)
+	check(context.Background())
+	check(context.Background())
+	if calls != 2 {
+		t.Errorf("calls without ttl = %d, want 2", calls)
+	}
+}
@@ -6,19 +6,30 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 type Input struct {
 	HookEventName  string          `json:"hook_event_name"`
 	TranscriptPath string          `json:"transcript_path"`
 	SessionID      string          `json:"session_id"`
+	Cwd            string          `json:"cwd"`
 	ToolName       string          `json:"tool_name"`
 	ToolInput      json.RawMessage `json:"tool_input"`
 }
 
+// Transcript is the part of a session transcript used in notifications.
+type Transcript struct {
+	Prompt   string
+	Response string
+	// PromptAt is when the last user prompt was submitted, or zero if unknown.
+	PromptAt time.Time
+}
+
 type transcriptEntry struct {
-	Type    string             `json:"type"`
-	Message *transcriptMessage `json:"message"`
+	Type      string             `json:"type"`
+	Timestamp time.Time          `json:"timestamp"`
+	Message   *transcriptMessage `json:"message"`
 }
 
 type transcriptMessage struct {
@@ -34,15 +45,25 @@ type contentBlock struct {
 // ScanTranscript reads a JSONL transcript file and returns the last user
 // prompt and the last assistant text response.
 func ScanTranscript(path string) (prompt, response string) {
+	t := ReadTranscript(path)
+	return t.Prompt, t.Response
+}
+
+// ReadTranscript reads a JSONL transcript file and returns the last user
+// prompt with its timestamp and the last assistant text response.
+func ReadTranscript(path string) Transcript {
+	t := Transcript{Prompt: "(unknown)"}
 	if path == "" {
-		return "(unknown)", ""
+		return t
 	}
 	f, err := os.Open(path)
 	if err != nil {
-		return "(unknown)", ""
+		return t
 	}
 	defer f.Close()
 
+	var prompt string
+
 	scanner := bufio.NewScanner(f)
 	scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024)
 	for scanner.Scan() {
@@ -60,35 +81,51 @@ func ScanTranscript(path string) (prompt, response string) {
 			var s string
 			if err := json.Unmarshal(entry.Message.Content, &s); err == nil {
 				prompt = s
+				t.PromptAt = entry.Timestamp
 			}
 		case entry.Type == "assistant" && entry.Message.Role == "assistant":
 			var blocks []contentBlock
 			if err := json.Unmarshal(entry.Message.Content, &blocks); err == nil {
 				for _, b := range blocks {
 					if b.Type == "text" && strings.TrimSpace(b.Text) != "" {
-						response = b.Text
+						t.Response = b.Text
 					}
 				}
 			}
 		}
 	}
 
-	if prompt == "" {
-		prompt = "(unknown)"
+	if prompt != "" {
+		t.Prompt = prompt
 	}
-	return prompt, response
+	return t
+}
+
+// Limits caps the length of message parts, in runes. Zero means no limit.
+type Limits struct {
+	Prompt   int
+	Detail   int
+	Response int
 }
 
+// DefaultLimits are the limits used by BuildMessage.
+var DefaultLimits = Limits{Prompt: 100, Detail: 200}
+
 // BuildMessage formats a Slack notification message from hook input.
 // When isReply is true, the Prompt line is omitted (it's already in the parent thread).
 func BuildMessage(input Input, prompt, response string, isReply bool) string {
+	return DefaultLimits.BuildMessage(input, prompt, response, isReply)
+}
+
+// BuildMessage is like the package-level BuildMessage but applies l.
+func (l Limits) BuildMessage(input Input, prompt, response string, isReply bool) string {
 	var b strings.Builder
 
 	switch input.HookEventName {
 	case "PermissionRequest":
 		b.WriteString(fmt.Sprintf("[PermissionRequest] %s", input.ToolName))
 		if detail := FormatToolInput(input.ToolName, input.ToolInput); detail != "" {
-			b.WriteString(fmt.Sprintf("\n> %s", Truncate(detail, 200)))
+			b.WriteString(fmt.Sprintf("\n> %s", truncateLimit(detail, l.Detail)))
 		}
 		if choices := PermissionChoices(input.ToolName); choices != "" {
 			b.WriteString(fmt.Sprintf("\n> %s", strings.ReplaceAll(choices, "\n", "\n> ")))
@@ -98,11 +135,16 @@ func BuildMessage(input Input, prompt, response string, isReply bool) string {
 	}
 
 	if !isReply {
-		b.WriteString(fmt.Sprintf("\nPrompt: %q", Truncate(prompt, 100)))
+		b.WriteString(fmt.Sprintf("\nPrompt: %q", truncateLimit(prompt, l.Prompt)))
 	}
 
 	// AskUserQuestion already shows the question and options; skip redundant response.
 	if response != "" && !(input.HookEventName == "PermissionRequest" && input.ToolName == "AskUserQuestion") {
+		if l.Response > 0 {
+			if runes := []rune(response); len(runes) > l.Response {
+				response = string(runes[:l.Response]) + "..."
+			}
+		}
 		b.WriteString(fmt.Sprintf("\nResponse: %s", strings.ReplaceAll(response, "\n", "\n> ")))
 	}
 
@@ -202,6 +244,14 @@ func PermissionChoices(toolName string) string {
 	}
 }
 
+// truncateLimit is Truncate, except that n <= 0 only replaces newlines.
+func truncateLimit(s string, n int) string {
+	if n <= 0 {
+		return strings.ReplaceAll(s, "\n", " ")
+	}
+	return Truncate(s, n)
+}
+
 // Truncate shortens a string to n runes, replacing newlines with spaces.
 func Truncate(s string, n int) string {
 	s = strings.ReplaceAll(s, "\n", " ")
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestScanTranscript(t *testing.T) {
@@ -64,6 +66,72 @@ func TestScanTranscript(t *testing.T) {
 	})
 }
 
+func TestReadTranscript(t *testing.T) {
+	t.Run("records when the last prompt was submitted", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "transcript.jsonl")
+		lines := []string{
+			`{"type":"user","timestamp":"2025-01-02T03:04:05Z","message":{"role":"user","content":"first"}}`,
+			`{"type":"user","timestamp":"2025-01-02T03:10:00Z","message":{"role":"user","content":"second"}}`,
+			`{"type":"user","timestamp":"2025-01-02T03:11:00Z","message":{"role":"user","content":[{"type":"tool_result","content":"result"}]}}`,
+			`{"type":"assistant","timestamp":"2025-01-02T03:12:00Z","message":{"role":"assistant","content":[{"type":"text","text":"done"}]}}`,
+		}
+		writeLines(t, path, lines)
+
+		tr := ReadTranscript(path)
+		if tr.Prompt != "second" {
+			t.Errorf("prompt = %q, want %q", tr.Prompt, "second")
+		}
+		if tr.Response != "done" {
+			t.Errorf("response = %q, want %q", tr.Response, "done")
+		}
+		want := time.Date(2025, 1, 2, 3, 10, 0, 0, time.UTC)
+		if !tr.PromptAt.Equal(want) {
+			t.Errorf("prompt at = %s, want %s", tr.PromptAt, want)
+		}
+	})
+
+	t.Run("leaves prompt time zero without timestamps", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "transcript.jsonl")
+		writeLines(t, path, []string{`{"type":"user","message":{"role":"user","content":"hi"}}`})
+
+		if tr := ReadTranscript(path); !tr.PromptAt.IsZero() {
+			t.Errorf("prompt at = %s, want zero", tr.PromptAt)
+		}
+	})
+}
+
+func TestLimitsBuildMessage(t *testing.T) {
+	t.Run("applies custom limits", func(t *testing.T) {
+		input := Input{
+			HookEventName: "PermissionRequest",
+			ToolName:      "Bash",
+			ToolInput:     json.RawMessage(`{"command":"echo 0123456789"}`),
+		}
+		l := Limits{Prompt: 5, Detail: 8, Response: 4}
+		msg := l.BuildMessage(input, "long prompt", "long response", false)
+		if !contains(msg, "> echo 012...") {
+			t.Errorf("detail should be truncated to 8 runes, got:\n%s", msg)
+		}
+		if !contains(msg, `Prompt: "long ..."`) {
+			t.Errorf("prompt should be truncated to 5 runes, got:\n%s", msg)
+		}
+		if !contains(msg, "Response: long...") {
+			t.Errorf("response should be truncated to 4 runes, got:\n%s", msg)
+		}
+	})
+
+	t.Run("zero limits keep full text", func(t *testing.T) {
+		input := Input{HookEventName: "Stop"}
+		prompt := strings.Repeat("p", 300)
+		msg := Limits{}.BuildMessage(input, prompt, "", false)
+		if !contains(msg, prompt) {
+			t.Errorf("prompt should not be truncated, got:\n%s", msg)
+		}
+	})
+}
+
 func TestBuildMessage(t *testing.T) {
 	t.Run("Stop event with prompt and response", func(t *testing.T) {
 		input := Input{HookEventName: "Stop"}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Common attribute keys, so the same value is logged under the same name
+// everywhere.
+const (
+	SessionID  = "session_id"
+	ThreadTS   = "thread_ts"
+	Event      = "event"
+	TmuxTarget = "tmux_target"
+	Channel    = "channel"
+	User       = "user"
+)
+
+// debug is set when the logger logs at debug level; message bodies are
+// then logged in full.
+var debug atomic.Bool
+
+// Setup installs the default slog logger writing to w. level is one of
+// debug, info, warn or error; format is text or json.
+func Setup(w io.Writer, level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(h))
+	debug.Store(l <= slog.LevelDebug)
+	return nil
+}
+
+// Body returns an attribute for message text such as a prompt or a Slack
+// reply. Unless debug logging is enabled, only the length and a short hash
+// of the text are logged, which is enough to correlate log lines without
+// keeping the content.
+func Body(key, text string) slog.Attr {
+	if debug.Load() {
+		return slog.String(key, text)
+	}
+	return slog.String(key, Redact(text))
+}
+
+// Redact summarizes text as its length and the first 12 hex digits of its
+// SHA-256 hash.
+func Redact(text string) string {
+	if text == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("[%d chars sha256:%s]", utf8.RuneCountInString(text), hex.EncodeToString(sum[:6]))
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	t.Run("json output with level filtering", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := Setup(&buf, "warn", "json"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		slog.Info("hidden")
+		slog.Warn("shown", SessionID, "sess-1")
+
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("output is not a single JSON line: %q", buf.String())
+		}
+		if entry["msg"] != "shown" || entry[SessionID] != "sess-1" {
+			t.Errorf("entry = %v", entry)
+		}
+	})
+
+	t.Run("rejects invalid settings", func(t *testing.T) {
+		if err := Setup(&bytes.Buffer{}, "loud", "text"); err == nil {
+			t.Error("expected error for invalid level")
+		}
+		if err := Setup(&bytes.Buffer{}, "info", "xml"); err == nil {
+			t.Error("expected error for invalid format")
+		}
+	})
+}
+
+func TestBody(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	text := "deploy with AWS_SECRET=abc"
+
+	Setup(&bytes.Buffer{}, "info", "text")
+	got := Body("text", text).Value.String()
+	if strings.Contains(got, "AWS_SECRET") {
+		t.Errorf("body should be redacted at info level, got %q", got)
+	}
+	if got != Redact(text) {
+		t.Errorf("body = %q, want %q", got, Redact(text))
+	}
+
+	Setup(&bytes.Buffer{}, "debug", "text")
+	if got := Body("text", text).Value.String(); got != text {
+		t.Errorf("body at debug level = %q, want %q", got, text)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	if got := Redact(""); got != "" {
+		t.Errorf("Redact(\"\") = %q, want empty", got)
+	}
+	a, b := Redact("hello"), Redact("hellO")
+	if !strings.HasPrefix(a, "[5 chars sha256:") {
+		t.Errorf("Redact = %q", a)
+	}
+	if a == b {
+		t.Error("different texts should have different hashes")
+	}
+	if a != Redact("hello") {
+		t.Error("hash should be stable")
+	}
+}
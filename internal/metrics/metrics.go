@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cc_slack"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	// HookEvents counts received hook events by event name and tool.
+	// Record events with HookEvent, which bounds the label values.
+	HookEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hook_events_total",
+		Help:      "Hook events received, by event name and tool.",
+	}, []string{"event", "tool"})
+
+	// HookDuration measures hook handling by stage: "transcript" for
+	// reading the transcript, "slack" for posting or updating the message.
+	HookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hook_duration_seconds",
+		Help:      "Time spent handling hook events, by stage.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"stage"})
+
+	// SlackErrors counts failed Slack API calls by method and error code.
+	// Every failed attempt is counted, including those that are retried.
+	SlackErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slack_api_errors_total",
+		Help:      "Failed Slack API calls, by method and error code.",
+	}, []string{"method", "code"})
+
+	// BotMessages counts Slack messages seen by the reply bot, by result
+	// ("forwarded" or "skipped") and the reason a message was skipped.
+	BotMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bot_messages_total",
+		Help:      "Thread messages forwarded to tmux or skipped, by reason.",
+	}, []string{"result", "reason"})
+
+	// PermissionWait measures how long sessions wait on a permission
+	// prompt, from the PermissionRequest until it is answered in Slack or
+	// the next event of the session. Record waits with PermissionWaited.
+	PermissionWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "permission_wait_seconds",
+		Help:      "Time from a permission request until it was answered, by tool.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"tool"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HookEvents,
+		HookDuration,
+		SlackErrors,
+		BotMessages,
+		PermissionWait,
+	)
+}
+
+// Forwarded records a bot message sent to tmux.
+func Forwarded() {
+	BotMessages.WithLabelValues("forwarded", "").Inc()
+}
+
+// Skipped records a bot message that was not sent to tmux.
+func Skipped(reason string) {
+	BotMessages.WithLabelValues("skipped", reason).Inc()
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// events are the hook event names recorded as they are. Others are
+// recorded as "other", so that clients cannot create series at will.
+var events = map[string]bool{
+	"PreToolUse": true, "PostToolUse": true, "PermissionRequest": true, "Notification": true,
+	"UserPromptSubmit": true, "Stop": true, "SubagentStop": true, "PreCompact": true,
+	"SessionStart": true, "SessionEnd": true,
+}
+
+// tools are the built-in Claude Code tools recorded as they are. MCP tools
+// are recorded as "mcp" and other tools as "other".
+var tools = map[string]bool{
+	"": true, "Bash": true, "BashOutput": true, "KillShell": true, "Read": true, "Write": true,
+	"Edit": true, "MultiEdit": true, "Glob": true, "Grep": true, "LS": true, "NotebookEdit": true,
+	"NotebookRead": true, "WebFetch": true, "WebSearch": true, "Task": true, "TodoWrite": true,
+	"ExitPlanMode": true, "AskUserQuestion": true, "SlashCommand": true, "Skill": true,
+}
+
+// HookEvent records a received hook event.
+func HookEvent(event, tool string) {
+	if !events[event] {
+		event = "other"
+	}
+	HookEvents.WithLabelValues(event, toolLabel(tool)).Inc()
+}
+
+// PermissionWaited records how long a prompt for tool waited.
+func PermissionWaited(tool string, d time.Duration) {
+	PermissionWait.WithLabelValues(toolLabel(tool)).Observe(d.Seconds())
+}
+
+func toolLabel(tool string) string {
+	switch {
+	case tools[tool]:
+		return tool
+	case strings.HasPrefix(tool, "mcp__"):
+		return "mcp"
+	}
+	return "other"
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	HookEvent("PermissionRequest", "Bash")
+	HookEvent("PermissionRequest", "mcp__github__create_issue")
+	HookEvent("Made-Up", "Nonsense")
+	HookDuration.WithLabelValues("slack").Observe(0.2)
+	SlackErrors.WithLabelValues("chat.postMessage", "ratelimited").Inc()
+	Forwarded()
+	Skipped("not_allowed")
+	PermissionWaited("Bash", 42*time.Second)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+
+	for _, want := range []string{
+		`cc_slack_hook_events_total{event="PermissionRequest",tool="Bash"} 1`,
+		`cc_slack_hook_events_total{event="PermissionRequest",tool="mcp"} 1`,
+		`cc_slack_hook_events_total{event="other",tool="other"} 1`,
+		`cc_slack_hook_duration_seconds_count{stage="slack"} 1`,
+		`cc_slack_slack_api_errors_total{code="ratelimited",method="chat.postMessage"} 1`,
+		`cc_slack_bot_messages_total{reason="",result="forwarded"} 1`,
+		`cc_slack_bot_messages_total{reason="not_allowed",result="skipped"} 1`,
+		`cc_slack_permission_wait_seconds_sum{tool="Bash"} 42`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics should contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package reaction
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Map maps emoji names to the option a reaction on a pending permission
+// prompt chooses: an option number, "last" for the last option, or "no"
+// for the option that denies the request.
+type Map map[string]string
+
+// Default is used when no reactions are configured.
+var Default = Map{
+	"white_check_mark": "1",
+	"fast_forward":     "2",
+	"x":                "no",
+}
+
+// Validate checks that every reaction maps to a valid option.
+func (r Map) Validate() error {
+	var errs []error
+	for name, choice := range r {
+		if name == "" || strings.Contains(name, ":") {
+			errs = append(errs, fmt.Errorf("reactions: invalid emoji name %q (use the name without colons)", name))
+		}
+		if choice == "last" || choice == "no" {
+			continue
+		}
+		if n, err := strconv.Atoi(choice); err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("reactions: %s: choice must be an option number, last or no, got %q", name, choice))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Choice returns the number of the option that reaction chooses among
+// options. Skin tone modifiers are ignored.
+func (r Map) Choice(reaction string, options []string) (int, bool) {
+	if len(r) == 0 {
+		r = Default
+	}
+	name, _, _ := strings.Cut(reaction, "::")
+	choice, ok := r[name]
+	if !ok || len(options) == 0 {
+		return 0, false
+	}
+	switch choice {
+	case "last":
+		return len(options), true
+	case "no":
+		for i, o := range options {
+			if o == "No" || strings.HasPrefix(o, "No,") {
+				return i + 1, true
+			}
+		}
+		return 0, false
+	}
+	n, err := strconv.Atoi(choice)
+	if err != nil || n < 1 || n > len(options) {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,55 @@
+package reaction
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChoice(t *testing.T) {
+	bash := []string{"Yes", "Yes, and don't ask again for this session", "No"}
+	plan := []string{"Yes, and auto-accept edits", "Yes, and bypass permissions", "Yes, manually approve edits"}
+	custom := Map{"rocket": "2", "stop_sign": "last"}
+
+	tests := []struct {
+		name      string
+		reactions Map
+		reaction  string
+		options   []string
+		want      int
+		wantOK    bool
+	}{
+		{"default yes", nil, "white_check_mark", bash, 1, true},
+		{"default don't ask again", nil, "fast_forward", bash, 2, true},
+		{"default no", nil, "x", bash, 3, true},
+		{"no without a deny option", nil, "x", plan, 0, false},
+		{"skin tone", Map{"+1": "1"}, "+1::skin-tone-3", bash, 1, true},
+		{"custom number", custom, "rocket", bash, 2, true},
+		{"custom last", custom, "stop_sign", plan, 3, true},
+		{"custom replaces defaults", custom, "white_check_mark", bash, 0, false},
+		{"out of range", Map{"eyes": "4"}, "eyes", bash, 0, false},
+		{"no options", nil, "white_check_mark", nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.reactions.Choice(tt.reaction, tt.options)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Choice(%q) = %d, %v, want %d, %v", tt.reaction, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Map{"x": "no", "fast_forward": "last", "rocket": "2"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := Map{":x:": "1", "eyes": "0"}.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{`invalid emoji name ":x:"`, `eyes: choice must be an option number, last or no, got "0"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
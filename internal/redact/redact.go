@@ -0,0 +1,241 @@
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern is a named secret detector. When the regular expression has a
+// group named "secret", only that group is replaced; otherwise the whole
+// match is.
+type Pattern struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// Config selects the detectors applied to outgoing messages.
+type Config struct {
+	// DisableBuiltin turns off the built-in credential detectors.
+	DisableBuiltin bool `yaml:"disable_builtin"`
+	// Patterns are additional detectors, applied after the built-in ones.
+	Patterns []Pattern `yaml:"patterns"`
+}
+
+// Compile validates the user-defined patterns and prepares them for matching.
+func (c *Config) Compile() error {
+	var errs []error
+	for i := range c.Patterns {
+		p := &c.Patterns[i]
+		if p.Name == "" {
+			errs = append(errs, fmt.Errorf("redact pattern %d: name is required", i+1))
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redact pattern %d: invalid pattern: %w", i+1, err))
+			continue
+		}
+		if re.MatchString("") {
+			errs = append(errs, fmt.Errorf("redact pattern %d: pattern matches the empty string", i+1))
+			continue
+		}
+		p.re = re
+	}
+	return errors.Join(errs...)
+}
+
+// builtin detects common credential formats. More specific detectors come
+// first so that their name is the one shown.
+var builtin = []Pattern{
+	{Name: "private-key", Pattern: `-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----(?s:.*?)(?:-----END [A-Z0-9 ]*PRIVATE KEY-----|\z)`},
+	{Name: "aws-key", Pattern: `\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`},
+	{Name: "aws-secret", Pattern: `(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`},
+	{Name: "github-token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`},
+	{Name: "slack-token", Pattern: `\b(?:xox[abeoprs]-[A-Za-z0-9-]{10,}|xapp-\d-[A-Za-z0-9-]{10,})`},
+	{Name: "anthropic-key", Pattern: `\bsk-ant-[A-Za-z0-9_-]{20,}`},
+	{Name: "openai-key", Pattern: `\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`},
+	{Name: "google-api-key", Pattern: `\bAIza[0-9A-Za-z_-]{35}`},
+	{Name: "stripe-key", Pattern: `\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}`},
+	{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`},
+	{Name: "bearer-token", Pattern: `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/-]{8,}=*)`},
+	{Name: "basic-auth", Pattern: `(?i)authorization:\s*basic\s+(?P<secret>[A-Za-z0-9+/]{8,}={0,2})`},
+	{Name: "url-password", Pattern: `(?i)\b[a-z][a-z0-9+.-]*://[^\s/:@]+:(?P<secret>[^\s/@]+)@`},
+	{Name: "secret", Pattern: `(?i)\b[A-Z0-9_.-]*(?:secret|token|passw(?:or)?d|pwd|api_?key|access_?key|private_?key|credentials?)[A-Z0-9_.-]*["']?\s*[:=]\s*(?P<secret>"[^"\n]+"|'[^'\n]+'|[^\s"',;]+)`},
+}
+
+func init() {
+	for i := range builtin {
+		builtin[i].re = regexp.MustCompile(builtin[i].Pattern)
+	}
+}
+
+// Redactor replaces secrets in text with [REDACTED:<name>].
+type Redactor struct {
+	patterns []Pattern
+}
+
+// Default applies the built-in detectors only.
+var Default = &Redactor{patterns: builtin}
+
+// New returns a Redactor for c. c must be compiled.
+func New(c Config) *Redactor {
+	var r Redactor
+	if !c.DisableBuiltin {
+		r.patterns = append(r.patterns, builtin...)
+	}
+	for _, p := range c.Patterns {
+		if p.re != nil {
+			r.patterns = append(r.patterns, p)
+		}
+	}
+	return &r
+}
+
+// String returns s with every detected secret replaced.
+func (r *Redactor) String(s string) string {
+	s, _ = r.redact(s)
+	return s
+}
+
+// Secret is a secret detected in a text: the bytes text[Start:End] and
+// the name of the detector that found them.
+type Secret struct {
+	Start, End int
+	Name       string
+}
+
+// Find returns the secrets that String replaces in s, in order. It lets
+// callers mask secrets in place, such as in text laid out on a screen.
+func (r *Redactor) Find(s string) []Secret {
+	_, marks := r.redact(s)
+	secrets := make([]Secret, len(marks))
+	for i, m := range marks {
+		secrets[i] = m.Secret
+	}
+	return secrets
+}
+
+// mark is a [REDACTED:<name>] mark in redacted text, at text[At:End], and
+// the secret it replaced in the original text.
+type mark struct {
+	At, End int
+	Secret
+}
+
+// redact applies the patterns in order and returns the redacted text with
+// its marks.
+func (r *Redactor) redact(s string) (string, []mark) {
+	var marks []mark
+	for _, p := range r.patterns {
+		s, marks = p.replace(s, marks)
+	}
+	return s, marks
+}
+
+// JSON redacts every string value in the JSON document raw. raw is
+// returned unchanged if it is not valid JSON.
+func (r *Redactor) JSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(r.value(v))
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+func (r *Redactor) value(v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case []any:
+		for i := range v {
+			v[i] = r.value(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = r.value(v[k])
+		}
+	}
+	return v
+}
+
+// replace redacts all matches of p in s, which has the earlier marks
+// marks, and returns the result with its marks. Values that are already
+// redacted, quoted or not, are left alone, so a generic detector does not
+// rename a specific one. A match overlapping a mark takes it in whole.
+func (p Pattern) replace(s string, marks []mark) (string, []mark) {
+	matches := p.re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s, marks
+	}
+	group := p.re.SubexpIndex("secret")
+	text := "[REDACTED:" + p.Name + "]"
+
+	var (
+		b   strings.Builder
+		out []mark
+		// last is the end of s written to b, and next the first mark
+		// not yet copied to out.
+		last, next int
+	)
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if group > 0 {
+			start, end = m[2*group], m[2*group+1]
+		}
+		if start < 0 || start == end || strings.HasPrefix(strings.TrimLeft(s[start:end], `"'`), "[REDACTED:") {
+			continue
+		}
+		for _, k := range marks {
+			if k.At < end && k.End > start {
+				start, end = min(start, k.At), max(end, k.End)
+			}
+		}
+		if start = max(start, last); start >= end {
+			continue
+		}
+
+		// Marks before the match move by what was written so far; the
+		// ones inside it are replaced by the new mark.
+		secret := Secret{Start: original(marks, start), End: original(marks, end), Name: p.Name}
+		offset := b.Len() - last
+		for ; next < len(marks) && marks[next].At < end; next++ {
+			if k := marks[next]; k.End <= start {
+				out = append(out, mark{At: k.At + offset, End: k.End + offset, Secret: k.Secret})
+			}
+		}
+		b.WriteString(s[last:start])
+		out = append(out, mark{At: b.Len(), End: b.Len() + len(text), Secret: secret})
+		b.WriteString(text)
+		last = end
+	}
+	offset := b.Len() - last
+	for _, k := range marks[next:] {
+		out = append(out, mark{At: k.At + offset, End: k.End + offset, Secret: k.Secret})
+	}
+	b.WriteString(s[last:])
+	return b.String(), out
+}
+
+// original maps position i of redacted text with marks, which is not
+// inside a mark, to the position in the original text.
+func original(marks []mark, i int) int {
+	shift := 0
+	for _, k := range marks {
+		if k.End > i {
+			break
+		}
+		shift += (k.End - k.At) - (k.Secret.End - k.Secret.Start)
+	}
+	return i - shift
+}
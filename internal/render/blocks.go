@@ -0,0 +1,164 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nktks/cc-slack/internal/hook"
+	"github.com/nktks/cc-slack/internal/slack"
+	slackapi "github.com/slack-go/slack"
+)
+
+// AnswerBlock is the block ID of the buttons answering a prompt. Each
+// button's value is the number of the option it selects.
+const AnswerBlock = "answer"
+
+const (
+	// maxSectionText is a little below Slack's 3000 character limit for
+	// section text, leaving room for the markup added around it.
+	maxSectionText = 2900
+	maxHeaderText  = 150
+	maxButtonText  = 75
+)
+
+// Blocks renders d as Block Kit blocks: a header with the event and tool,
+// the tool detail, the prompt and response, buttons for the options of a
+// permission prompt, and the session context. Parts are truncated to l.
+func Blocks(d Data, l hook.Limits) slack.Blocks {
+	header := d.Event
+	if d.Tool != "" {
+		header += ": " + d.Tool
+	}
+	blocks := slack.Blocks{
+		slackapi.NewHeaderBlock(plain(truncate(header, maxHeaderText))),
+	}
+
+	if d.Detail != "" {
+		detail := escape(truncate(d.Detail, limit(l.Detail)))
+		switch d.Tool {
+		case "Bash":
+			// Breaking up fences lengthens the text, so it comes first.
+			detail = code(fit(breakFences(detail)))
+		case "Write", "Edit", "Read":
+			detail = "`" + fit(detail) + "`"
+		default:
+			detail = fit(detail)
+		}
+		blocks = append(blocks, section(detail))
+	}
+	if !d.Reply {
+		prompt := strings.ReplaceAll(truncate(d.Prompt, limit(l.Prompt)), "\n", " ")
+		blocks = append(blocks, section("*Prompt:* "+fit(escape(prompt))))
+	}
+	// AskUserQuestion already shows the question and options.
+	if d.Response != "" && !(d.Event == "PermissionRequest" && d.Tool == "AskUserQuestion") {
+		blocks = append(blocks, section("*Response:*\n"+fit(escape(truncate(d.Response, limit(l.Response))))))
+	}
+
+	if len(d.Options) > 0 {
+		var buttons []slackapi.BlockElement
+		for i, o := range d.Options {
+			label := truncate(fmt.Sprintf("%d. %s", i+1, o), maxButtonText)
+			buttons = append(buttons, slackapi.NewButtonBlockElement(
+				fmt.Sprintf("%s_%d", AnswerBlock, i+1), fmt.Sprint(i+1), plain(label)))
+		}
+		blocks = append(blocks, slackapi.NewActionBlock(AnswerBlock, buttons...))
+	}
+
+	if context := contextElements(d.Session); len(context) > 0 {
+		blocks = append(blocks, slackapi.NewContextBlock("", context...))
+	}
+	return blocks
+}
+
+// contextElements describes the session: its ID, directory, branch and
+// the time of the event.
+func contextElements(s Session) []slackapi.MixedElement {
+	var parts []string
+	if s.ID != "" {
+		parts = append(parts, "session `"+truncateID(s.ID)+"`")
+	}
+	if s.Cwd != "" {
+		parts = append(parts, ":file_folder: `"+escape(s.Cwd)+"`")
+	}
+	if s.Branch != "" {
+		parts = append(parts, ":twisted_rightwards_arrows: `"+escape(s.Branch)+"`")
+	}
+	if !s.Time.IsZero() {
+		parts = append(parts, fmt.Sprintf("<!date^%d^{time}|%s>", s.Time.Unix(), s.Time.Format("15:04:05")))
+	}
+	var elements []slackapi.MixedElement
+	for _, p := range parts {
+		elements = append(elements, slackapi.NewTextBlockObject(slackapi.MarkdownType, p, false, false))
+	}
+	return elements
+}
+
+// Note returns a context block with text, for remarks added around a
+// notification such as a mention or its update time.
+func Note(text string) slackapi.Block {
+	return slackapi.NewContextBlock("", slackapi.NewTextBlockObject(slackapi.MarkdownType, text, false, false))
+}
+
+// Resolved marks msg with status, for a prompt that has been answered.
+// Buttons are removed, since they can no longer be used.
+func Resolved(msg slack.Message, status string) slack.Message {
+	msg.Text += "\n" + status
+	if len(msg.Blocks) == 0 {
+		return msg
+	}
+	var blocks slack.Blocks
+	for _, b := range msg.Blocks {
+		if b.BlockType() != slackapi.MBTAction {
+			blocks = append(blocks, b)
+		}
+	}
+	msg.Blocks = append(blocks, Note(status))
+	return msg
+}
+
+func section(text string) slackapi.Block {
+	return slackapi.NewSectionBlock(slackapi.NewTextBlockObject(slackapi.MarkdownType, text, false, false), nil, nil)
+}
+
+func plain(text string) *slackapi.TextBlockObject {
+	return slackapi.NewTextBlockObject(slackapi.PlainTextType, text, false, false)
+}
+
+// limit caps a configured limit at what fits in a section. Zero means no
+// configured limit.
+func limit(n int) int {
+	if n <= 0 || n > maxSectionText {
+		return maxSectionText
+	}
+	return n
+}
+
+// fit truncates escaped text to maxSectionText characters. Escaping can
+// make text several times longer, so text truncated to its limit before
+// escaping may still not fit in a section. An entity cut in half is dropped.
+func fit(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxSectionText {
+		return s
+	}
+	s = string(runes[:maxSectionText])
+	if i := strings.LastIndexByte(s, '&'); i >= 0 && !strings.Contains(s[i:], ";") {
+		s = s[:i]
+	}
+	return s + "..."
+}
+
+// truncateID shortens a session ID to its first block, which is enough to
+// tell sessions apart.
+func truncateID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// escape escapes the characters that Slack's mrkdwn treats as markup.
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
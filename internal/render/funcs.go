@@ -0,0 +1,122 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Funcs are the helper functions available in templates. Arguments may be
+// of any type, so that values from .ToolInput can be passed directly;
+// missing values are treated as empty strings.
+var Funcs = template.FuncMap{
+	// truncate shortens text to n runes, adding "..." when cut.
+	"truncate": func(n int, v any) string { return truncate(str(v), n) },
+	// oneline replaces newlines with spaces.
+	"oneline": func(v any) string { return strings.ReplaceAll(str(v), "\n", " ") },
+	// quote prefixes every line with "> ".
+	"quote": func(v any) string { return "> " + strings.ReplaceAll(str(v), "\n", "\n> ") },
+	// code wraps text in a code block.
+	"code": func(v any) string { return code(str(v)) },
+	// diff returns a line diff from old to new, prefixing removed lines
+	// with "-", added lines with "+" and unchanged lines with " ".
+	"diff": func(old, new any) string { return diff(str(old), str(new)) },
+	// json quotes text as a JSON string, for use in blocks templates.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(str(v))
+		return string(b), err
+	},
+}
+
+func str(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
+
+// code wraps s in a Slack code block. Backtick fences inside s would end
+// the block early, so they are broken up with zero-width spaces.
+func code(s string) string {
+	return "```\n" + strings.TrimRight(breakFences(s), "\n") + "\n```"
+}
+
+// breakFences breaks up the backtick fences in s with zero-width spaces.
+func breakFences(s string) string {
+	return strings.ReplaceAll(s, "```", "`​`​`")
+}
+
+// maxDiffLines bounds the quadratic line diff. Larger inputs are shown as
+// all old lines removed and all new lines added.
+const maxDiffLines = 1000
+
+func diff(old, new string) string {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	var out []string
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		for _, l := range a {
+			out = append(out, "-"+l)
+		}
+		for _, l := range b {
+			out = append(out, "+"+l)
+		}
+		return strings.Join(out, "\n")
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
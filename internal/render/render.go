@@ -0,0 +1,212 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/hook"
+	"github.com/nktks/cc-slack/internal/slack"
+)
+
+// Data is what a template sees.
+type Data struct {
+	// Event is the hook event name, e.g. PermissionRequest.
+	Event string
+	// Tool is the tool name, empty for events without a tool.
+	Tool string
+	// Detail is the most relevant field of the tool input: the command for
+	// Bash, the file path for Write, Edit and Read, and the questions for
+	// AskUserQuestion.
+	Detail string
+	// Choices are the numbered options of a permission prompt, one per line.
+	Choices string
+	// Options are the answers to a permission prompt or to a single
+	// AskUserQuestion question, in the order of their numbers.
+	Options []string
+	// ToolInput is the decoded tool input, e.g. .ToolInput.command.
+	ToolInput map[string]any
+	// Prompt is the last user prompt and Response the last assistant text.
+	Prompt   string
+	Response string
+	// Reply is true when the message is posted in the session's thread.
+	Reply   bool
+	Session Session
+}
+
+// Session describes the Claude Code session an event comes from.
+type Session struct {
+	ID         string
+	Cwd        string
+	TmuxTarget string
+	// Owner is the X-Cc-Slack-User identity in team mode.
+	Owner string
+	// Branch is the git branch checked out in Cwd, if known.
+	Branch string
+	// Duration is how long the current turn has run, or zero if unknown.
+	Duration time.Duration
+	// Time is when the event was received.
+	Time time.Time
+}
+
+// NewData prepares input for a template.
+func NewData(input hook.Input, prompt, response string, reply bool, session Session) Data {
+	d := Data{
+		Event:    input.HookEventName,
+		Tool:     input.ToolName,
+		Detail:   hook.FormatToolInput(input.ToolName, input.ToolInput),
+		Prompt:   prompt,
+		Response: response,
+		Reply:    reply,
+		Session:  session,
+	}
+	if len(input.ToolInput) > 0 {
+		// Tool inputs that are not objects leave ToolInput empty.
+		_ = json.Unmarshal(input.ToolInput, &d.ToolInput)
+	}
+	if d.Event == "PermissionRequest" {
+		d.Choices = hook.PermissionChoices(input.ToolName)
+		d.Options = options(d.Choices, d.ToolInput)
+	}
+	return d
+}
+
+// Options returns the answers to the permission prompt input, or nil if
+// input is not a permission prompt.
+func Options(input hook.Input) []string {
+	if input.HookEventName != "PermissionRequest" {
+		return nil
+	}
+	var toolInput map[string]any
+	if len(input.ToolInput) > 0 {
+		_ = json.Unmarshal(input.ToolInput, &toolInput)
+	}
+	return options(hook.PermissionChoices(input.ToolName), toolInput)
+}
+
+// options lists the answers of a permission prompt. AskUserQuestion
+// options are only listed for a single question, since the numbers of
+// later questions depend on the answers to earlier ones.
+func options(choices string, toolInput map[string]any) []string {
+	if choices == "" {
+		questions, _ := toolInput["questions"].([]any)
+		if len(questions) != 1 {
+			return nil
+		}
+		q, _ := questions[0].(map[string]any)
+		opts, _ := q["options"].([]any)
+		var labels []string
+		for _, o := range opts {
+			om, _ := o.(map[string]any)
+			if label, ok := om["label"].(string); ok {
+				labels = append(labels, label)
+			}
+		}
+		return labels
+	}
+	var labels []string
+	for _, line := range strings.Split(choices, "\n") {
+		if _, label, ok := strings.Cut(line, ". "); ok {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// Template renders the messages of the events it matches.
+type Template struct {
+	// Event and Tool select the events; empty matches any.
+	Event string `yaml:"event"`
+	Tool  string `yaml:"tool"`
+	// Text is a Go text/template producing the message text.
+	Text string `yaml:"text"`
+	// Blocks is a Go text/template producing a JSON array of Block Kit
+	// blocks. The message text is then only the notification fallback.
+	Blocks string `yaml:"blocks"`
+
+	text   *template.Template
+	blocks *template.Template
+}
+
+// Set is an ordered list of templates. The first matching template wins.
+type Set []Template
+
+// Compile validates the templates and parses them.
+func (s Set) Compile() error {
+	var errs []error
+	for i := range s {
+		t := &s[i]
+		if t.Text == "" && t.Blocks == "" {
+			errs = append(errs, fmt.Errorf("template %d: text or blocks is required", i+1))
+			continue
+		}
+		var err error
+		if t.Text != "" {
+			if t.text, err = parse(i, "text", t.Text); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if t.Blocks != "" {
+			if t.blocks, err = parse(i, "blocks", t.Blocks); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Match returns the first compiled template for event and tool.
+func (s Set) Match(event, tool string) (*Template, bool) {
+	for i := range s {
+		t := &s[i]
+		if t.text == nil && t.blocks == nil {
+			continue
+		}
+		if (t.Event == "" || t.Event == event) && (t.Tool == "" || t.Tool == tool) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Execute renders the message text for d. It returns false if the
+// template only has blocks.
+func (t *Template) Execute(d Data) (string, bool, error) {
+	if t.text == nil {
+		return "", false, nil
+	}
+	var b strings.Builder
+	if err := t.text.Execute(&b, d); err != nil {
+		return "", true, err
+	}
+	return strings.TrimSpace(b.String()), true, nil
+}
+
+// ExecuteBlocks renders the message blocks for d. It returns false if the
+// template has no blocks.
+func (t *Template) ExecuteBlocks(d Data) (slack.Blocks, bool, error) {
+	if t.blocks == nil {
+		return nil, false, nil
+	}
+	var b bytes.Buffer
+	if err := t.blocks.Execute(&b, d); err != nil {
+		return nil, true, err
+	}
+	var blocks slack.Blocks
+	if err := json.Unmarshal(b.Bytes(), &blocks); err != nil {
+		return nil, true, fmt.Errorf("decode blocks: %w", err)
+	}
+	return blocks, true, nil
+}
+
+func parse(i int, field, text string) (*template.Template, error) {
+	tmpl, err := template.New(fmt.Sprintf("template %d %s", i+1, field)).Funcs(Funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %d: %s: %w", i+1, field, err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,242 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nktks/cc-slack/internal/hook"
+	slackapi "github.com/slack-go/slack"
+)
+
+func TestSetMatch(t *testing.T) {
+	set := Set{
+		{Event: "PermissionRequest", Tool: "Bash", Text: "bash"},
+		{Event: "PermissionRequest", Text: "permission"},
+		{Tool: "Edit", Text: "edit"},
+	}
+	if err := set.Compile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		event, tool string
+		want        string
+	}{
+		{"PermissionRequest", "Bash", "bash"},
+		{"PermissionRequest", "Write", "permission"},
+		{"PostToolUse", "Edit", "edit"},
+		{"Stop", "", ""},
+	}
+	for _, tt := range tests {
+		tmpl, ok := set.Match(tt.event, tt.tool)
+		got := ""
+		if ok {
+			got = tmpl.Text
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q, %q) = %q, want %q", tt.event, tt.tool, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	set := Set{{Event: "Stop"}, {Text: "{{.Event"}, {Text: "{{nosuchfunc .Event}}"}}
+	err := set.Compile()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"template 1: text or blocks is required", "template 2: text:", "template 3: text:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	input := hook.Input{
+		HookEventName: "PermissionRequest",
+		ToolName:      "Bash",
+		ToolInput:     json.RawMessage(`{"command":"go test ./...","description":"Run tests"}`),
+	}
+	d := NewData(input, "please fix the flaky test", "", false, Session{ID: "sess-1", Cwd: "/work/api"})
+
+	set := Set{{Text: `
+*{{.Tool}}* in {{.Session.Cwd}}: {{.ToolInput.description}}
+{{code .Detail}}
+{{if not .Reply}}{{.Prompt | truncate 10 | quote}}{{end}}
+`}}
+	if err := set.Compile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tmpl, _ := set.Match(d.Event, d.Tool)
+	got, _, err := tmpl.Execute(d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "*Bash* in /work/api: Run tests\n```\ngo test ./...\n```\n> please fix..."
+	if got != want {
+		t.Errorf("Execute() = %q, want %q", got, want)
+	}
+	if !strings.HasPrefix(d.Choices, "1. Yes") {
+		t.Errorf("Choices = %q, want the permission options", d.Choices)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name, old, new string
+		want           string
+	}{
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n", " a\n-b\n+B\n c"},
+		{"added", "a", "a\nb", " a\n+b"},
+		{"removed", "a\nb", "b", "-a\n b"},
+		{"from empty", "", "x", "+x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff(tt.old, tt.new); got != tt.want {
+				t.Errorf("diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"truncate", `{{truncate 3 "abcdef"}}`, "abc..."},
+		{"truncate short", `{{truncate 10 "abc"}}`, "abc"},
+		{"oneline", `{{oneline "a\nb"}}`, "a b"},
+		{"quote", `{{quote "a\nb"}}`, "> a\n> b"},
+		{"code escapes fences", "{{code \"x```y\"}}", "```\nx`​`​`y\n```"},
+		{"missing value", `{{truncate 3 .ToolInput.nothing}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := Set{{Text: tt.text}}
+			if err := set.Compile(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, _, err := set[0].Execute(Data{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	input := hook.Input{
+		HookEventName: "PermissionRequest",
+		ToolName:      "Bash",
+		ToolInput:     json.RawMessage(`{"command":"rm -rf build && make <all>"}`),
+	}
+	at := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	d := NewData(input, "clean up", "", false, Session{ID: "0123456789abcdef", Cwd: "/work/api", Branch: "main", Time: at})
+	blocks := Blocks(d, hook.Limits{})
+
+	var types []string
+	for _, b := range blocks {
+		types = append(types, string(b.BlockType()))
+	}
+	if got, want := strings.Join(types, ","), "header,section,section,actions,context"; got != want {
+		t.Fatalf("block types = %s, want %s", got, want)
+	}
+
+	if got := blocks[0].(*slackapi.HeaderBlock).Text.Text; got != "PermissionRequest: Bash" {
+		t.Errorf("header = %q", got)
+	}
+	if got, want := blocks[1].(*slackapi.SectionBlock).Text.Text, "```\nrm -rf build &amp;&amp; make &lt;all&gt;\n```"; got != want {
+		t.Errorf("detail = %q, want %q", got, want)
+	}
+	actions := blocks[3].(*slackapi.ActionBlock)
+	if actions.BlockID != AnswerBlock || len(actions.Elements.ElementSet) != 3 {
+		t.Fatalf("actions = %+v, want 3 answer buttons", actions)
+	}
+	if b := actions.Elements.ElementSet[2].(*slackapi.ButtonBlockElement); b.Value != "3" || b.Text.Text != "3. No" {
+		t.Errorf("button 3 = %q %q, want 3. No", b.Value, b.Text.Text)
+	}
+
+	var context []string
+	for _, e := range blocks[4].(*slackapi.ContextBlock).ContextElements.Elements {
+		context = append(context, e.(*slackapi.TextBlockObject).Text)
+	}
+	want := []string{"session `01234567`", ":file_folder: `/work/api`", ":twisted_rightwards_arrows: `main`", fmt.Sprintf("<!date^%d^{time}|15:04:05>", at.Unix())}
+	if strings.Join(context, "|") != strings.Join(want, "|") {
+		t.Errorf("context = %q, want %q", context, want)
+	}
+}
+
+func TestBlocksFitSections(t *testing.T) {
+	markup := strings.Repeat("<a>", 1000)
+	input := hook.Input{
+		HookEventName: "PermissionRequest",
+		ToolName:      "Bash",
+		ToolInput:     json.RawMessage(`{"command":"` + strings.Repeat("```&", 1000) + `"}`),
+	}
+	d := NewData(input, markup, markup, false, Session{})
+	for _, b := range Blocks(d, hook.Limits{}) {
+		s, ok := b.(*slackapi.SectionBlock)
+		if !ok {
+			continue
+		}
+		text := s.Text.Text
+		if n := utf8.RuneCountInString(text); n > 3000 {
+			t.Errorf("section has %d characters, want at most 3000: %.40q", n, text)
+		}
+		if i := strings.LastIndexByte(text, '&'); i >= 0 && !strings.Contains(text[i:], ";") {
+			t.Errorf("section ends in a cut entity: %q", text[max(i-10, 0):])
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	single := hook.Input{
+		HookEventName: "PermissionRequest",
+		ToolName:      "AskUserQuestion",
+		ToolInput:     json.RawMessage(`{"questions":[{"question":"Which DB?","options":[{"label":"Postgres"},{"label":"SQLite"}]}]}`),
+	}
+	if got := NewData(single, "", "", false, Session{}).Options; strings.Join(got, ",") != "Postgres,SQLite" {
+		t.Errorf("single question options = %q", got)
+	}
+
+	multi := single
+	multi.ToolInput = json.RawMessage(`{"questions":[{"question":"A?","options":[{"label":"x"}]},{"question":"B?","options":[{"label":"y"}]}]}`)
+	if got := NewData(multi, "", "", false, Session{}).Options; got != nil {
+		t.Errorf("multiple questions options = %q, want none", got)
+	}
+
+	stop := hook.Input{HookEventName: "Stop"}
+	if got := NewData(stop, "", "", false, Session{}).Options; got != nil {
+		t.Errorf("Stop options = %q, want none", got)
+	}
+}
+
+func TestExecuteBlocks(t *testing.T) {
+	set := Set{{Blocks: `[{"type":"section","text":{"type":"mrkdwn","text":{{json .Detail}}}}]`}}
+	if err := set.Compile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d := NewData(hook.Input{HookEventName: "PermissionRequest", ToolName: "Read", ToolInput: json.RawMessage(`{"file_path":"a \"b\".go"}`)}, "", "", false, Session{})
+
+	if _, ok, _ := set[0].Execute(d); ok {
+		t.Error("blocks-only template should have no text")
+	}
+	blocks, ok, err := set[0].ExecuteBlocks(d)
+	if !ok || err != nil {
+		t.Fatalf("ExecuteBlocks() = %v, %v", ok, err)
+	}
+	if got := blocks[0].(*slackapi.SectionBlock).Text.Text; got != `a "b".go` {
+		t.Errorf("section = %q", got)
+	}
+}
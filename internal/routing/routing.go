@@ -0,0 +1,187 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route sends sessions matching all of its non-empty conditions to Channel.
+type Route struct {
+	// Cwd is a directory; sessions running in it or below it match.
+	// A leading "~/" is expanded to the home directory.
+	Cwd string `yaml:"cwd"`
+	// GitRemote is a regular expression matched against the URL of the
+	// "origin" remote of the session's working directory.
+	GitRemote string `yaml:"git_remote"`
+	// Header matches the X-Cc-Slack-Route header sent by the hook client.
+	Header string `yaml:"header"`
+	// Channel is the channel ID (C...) or user ID (U...) for DM.
+	Channel string `yaml:"channel"`
+	// MentionUser is the user ID to mention. When empty, the DM user is
+	// mentioned for user ID channels and nobody otherwise.
+	MentionUser string `yaml:"mention_user"`
+
+	cwd       string
+	gitRemote *regexp.Regexp
+}
+
+// Request describes where a hook event comes from.
+type Request struct {
+	Cwd    string
+	Header string
+	// GitRemote returns the origin URL for Cwd. It is only called when a
+	// route needs it, since it runs git.
+	GitRemote func() string
+}
+
+// Table is an ordered list of routes. The first matching route wins.
+type Table []Route
+
+// Compile validates the routes and prepares them for matching.
+func (t Table) Compile() error {
+	var errs []error
+	for i := range t {
+		r := &t[i]
+		if r.Channel == "" {
+			errs = append(errs, fmt.Errorf("route %d: channel is required", i+1))
+		}
+		if r.Cwd == "" && r.GitRemote == "" && r.Header == "" {
+			errs = append(errs, fmt.Errorf("route %d: at least one of cwd, git_remote or header is required", i+1))
+		}
+		if r.Cwd != "" {
+			r.cwd = filepath.Clean(expandHome(r.Cwd))
+		}
+		if r.GitRemote != "" {
+			re, err := regexp.Compile(r.GitRemote)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("route %d: invalid git_remote pattern: %w", i+1, err))
+				continue
+			}
+			r.gitRemote = re
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Match returns the first route matching req.
+func (t Table) Match(req Request) (Route, bool) {
+	var remote *string
+	for _, r := range t {
+		if r.Header != "" && r.Header != req.Header {
+			continue
+		}
+		if r.cwd != "" && !underDir(req.Cwd, r.cwd) {
+			continue
+		}
+		if r.gitRemote != nil {
+			if remote == nil {
+				var v string
+				if req.GitRemote != nil {
+					v = req.GitRemote()
+				}
+				remote = &v
+			}
+			if *remote == "" || !r.gitRemote.MatchString(*remote) {
+				continue
+			}
+		}
+		return r, true
+	}
+	return Route{}, false
+}
+
+// GitRemote returns the URL of the "origin" remote of the repository
+// containing dir, or empty string if there is none.
+func GitRemote(dir string) string {
+	return git(dir, "remote", "get-url", "origin")
+}
+
+// GitBranch returns the branch checked out in the repository containing
+// dir, or empty string if there is none or HEAD is detached.
+func GitBranch(dir string) string {
+	return git(dir, "branch", "--show-current")
+}
+
+const (
+	// gitTimeout bounds a git command, so that a slow file system or a
+	// large repository cannot hold up the events of a session.
+	gitTimeout = 2 * time.Second
+	// gitCacheTTL is how long the output of a git command is reused.
+	gitCacheTTL = 10 * time.Second
+)
+
+type gitResult struct {
+	out string
+	at  time.Time
+}
+
+// gitCache holds recent git output by directory and command, since every
+// event of a session asks the same of the same directory.
+var gitCache = struct {
+	sync.Mutex
+	results map[string]gitResult
+}{results: make(map[string]gitResult)}
+
+// git runs git with args in dir and returns its trimmed output, or empty
+// string if dir is empty or the command fails or times out.
+func git(dir string, args ...string) string {
+	if dir == "" {
+		return ""
+	}
+	key := dir + "\x00" + strings.Join(args, " ")
+	gitCache.Lock()
+	r, ok := gitCache.results[key]
+	gitCache.Unlock()
+	if ok && time.Since(r.at) < gitCacheTTL {
+		return r.out
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if err != nil {
+		out = nil
+	}
+	r = gitResult{out: strings.TrimSpace(string(out)), at: time.Now()}
+
+	gitCache.Lock()
+	defer gitCache.Unlock()
+	for k, old := range gitCache.results {
+		if time.Since(old.at) >= gitCacheTTL {
+			delete(gitCache.results, k)
+		}
+	}
+	gitCache.results[key] = r
+	return r.out
+}
+
+// underDir reports whether path is dir or inside it.
+func underDir(path, dir string) bool {
+	if path == "" {
+		return false
+	}
+	path = filepath.Clean(path)
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func expandHome(p string) string {
+	if !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[2:])
+}
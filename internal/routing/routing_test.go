@@ -0,0 +1,145 @@
+package routing
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	table := Table{
+		{Header: "personal", Channel: "U111"},
+		{Cwd: "/work/api", Channel: "C_API", MentionUser: "U222"},
+		{GitRemote: `github\.com[:/]acme/web`, Channel: "C_WEB"},
+		{Cwd: "/work", Channel: "C_WORK"},
+	}
+	if err := table.Compile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	remote := func(url string) func() string {
+		return func() string { return url }
+	}
+	tests := []struct {
+		name    string
+		req     Request
+		want    string
+		matched bool
+	}{
+		{"header wins", Request{Cwd: "/work/api", Header: "personal"}, "U111", true},
+		{"cwd prefix", Request{Cwd: "/work/api/cmd"}, "C_API", true},
+		{"cwd exact", Request{Cwd: "/work/api"}, "C_API", true},
+		{"sibling dir is not a prefix", Request{Cwd: "/work/apiserver"}, "C_WORK", true},
+		{"git remote", Request{Cwd: "/src/web", GitRemote: remote("git@github.com:acme/web.git")}, "C_WEB", true},
+		{"git remote before later cwd", Request{Cwd: "/work/web", GitRemote: remote("https://github.com/acme/web")}, "C_WEB", true},
+		{"no match", Request{Cwd: "/tmp"}, "", false},
+		{"no cwd", Request{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := table.Match(tt.req)
+			if ok != tt.matched || r.Channel != tt.want {
+				t.Errorf("Match = %q (ok=%v), want %q (ok=%v)", r.Channel, ok, tt.want, tt.matched)
+			}
+		})
+	}
+}
+
+func TestMatchCallsGitRemoteOnce(t *testing.T) {
+	table := Table{
+		{GitRemote: "a", Channel: "C1"},
+		{GitRemote: "b", Channel: "C2"},
+		{GitRemote: "c", Channel: "C3"},
+	}
+	table.Compile()
+
+	calls := 0
+	r, _ := table.Match(Request{GitRemote: func() string { calls++; return "c" }})
+	if r.Channel != "C3" {
+		t.Errorf("channel = %q, want %q", r.Channel, "C3")
+	}
+	if calls != 1 {
+		t.Errorf("git remote calls = %d, want 1", calls)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+	}{
+		{"missing channel", Route{Cwd: "/work"}},
+		{"missing condition", Route{Channel: "C1"}},
+		{"invalid pattern", Route{GitRemote: "(", Channel: "C1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (Table{tt.route}).Compile(); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCompileExpandsHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	table := Table{{Cwd: "~/src", Channel: "C1"}}
+	table.Compile()
+	if _, ok := table.Match(Request{Cwd: filepath.Join(home, "src", "repo")}); !ok {
+		t.Error("expected ~/src to match a directory under the home directory")
+	}
+}
+
+func TestGitRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", "git@github.com:acme/web.git"},
+	} {
+		if err := exec.Command("git", append([]string{"-C", dir}, args...)...).Run(); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+
+	if got := GitRemote(dir); got != "git@github.com:acme/web.git" {
+		t.Errorf("GitRemote = %q, want %q", got, "git@github.com:acme/web.git")
+	}
+	if got := GitRemote(t.TempDir()); got != "" {
+		t.Errorf("GitRemote outside a repository = %q, want empty", got)
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		if err := exec.Command("git", append([]string{"-C", dir}, args...)...).Run(); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	run("init", "-q", "-b", "main")
+
+	if got := GitBranch(dir); got != "main" {
+		t.Errorf("GitBranch = %q, want main", got)
+	}
+	// The branch is cached for a short time.
+	run("checkout", "-q", "-b", "feature")
+	if got := GitBranch(dir); got != "main" {
+		t.Errorf("cached GitBranch = %q, want main", got)
+	}
+	gitCache.Lock()
+	clear(gitCache.results)
+	gitCache.Unlock()
+	if got := GitBranch(dir); got != "feature" {
+		t.Errorf("GitBranch after expiry = %q, want feature", got)
+	}
+}
@@ -0,0 +1,188 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action decides what happens to a hook event.
+type Action string
+
+const (
+	// Notify posts the event with a mention.
+	Notify Action = "notify"
+	// Silent posts the event without a mention.
+	Silent Action = "silent"
+	// Drop does not post the event.
+	Drop Action = "drop"
+)
+
+// Event is the part of a hook event that rules match on.
+type Event struct {
+	Name  string
+	Tool  string
+	Input string
+	Cwd   string
+	// Duration is how long the current turn has been running, or zero if unknown.
+	Duration time.Duration
+}
+
+// Rule matches events and assigns them an action. Empty fields match anything.
+type Rule struct {
+	// Event is the exact hook event name, e.g. "PermissionRequest".
+	Event string `yaml:"event"`
+	// Tool is the exact tool name, e.g. "Bash".
+	Tool string `yaml:"tool"`
+	// Input is a regular expression matched against the tool input.
+	Input string `yaml:"input"`
+	// Cwd is a glob matched against the session's working directory.
+	// "*" matches within a path segment and "**" across segments.
+	Cwd string `yaml:"cwd"`
+	// MinDuration matches turns running at least this long.
+	MinDuration Duration `yaml:"min_duration"`
+	// MaxDuration matches turns running less than this long.
+	MaxDuration Duration `yaml:"max_duration"`
+	Action      Action   `yaml:"action"`
+
+	input *regexp.Regexp
+	cwd   *regexp.Regexp
+}
+
+// Duration is a time.Duration written as a string such as "30s" in YAML.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, node.Value)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Set is an ordered list of rules. The first matching rule wins.
+type Set struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads and compiles a rules file.
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules: %w", err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse decodes and compiles rules from YAML.
+func Parse(data []byte) (*Set, error) {
+	var s Set
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	if err := s.Compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Compile validates the rules and prepares their patterns for matching.
+func (s *Set) Compile() error {
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		switch r.Action {
+		case Notify, Silent, Drop:
+		default:
+			return fmt.Errorf("rule %d: action must be notify, silent or drop, got %q", i+1, r.Action)
+		}
+		if r.Input != "" {
+			re, err := regexp.Compile(r.Input)
+			if err != nil {
+				return fmt.Errorf("rule %d: invalid input pattern: %w", i+1, err)
+			}
+			r.input = re
+		}
+		if r.Cwd != "" {
+			r.cwd = globRegexp(r.Cwd)
+		}
+		if r.MinDuration > 0 && r.MaxDuration > 0 && r.MinDuration >= r.MaxDuration {
+			return fmt.Errorf("rule %d: min_duration must be less than max_duration", i+1)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the action of the first rule matching ev, or Notify if
+// none match. A nil Set notifies for every event.
+func (s *Set) Evaluate(ev Event) Action {
+	if s == nil {
+		return Notify
+	}
+	for _, r := range s.Rules {
+		if r.matches(ev) {
+			return r.Action
+		}
+	}
+	return Notify
+}
+
+func (r *Rule) matches(ev Event) bool {
+	if r.Event != "" && r.Event != ev.Name {
+		return false
+	}
+	if r.Tool != "" && r.Tool != ev.Tool {
+		return false
+	}
+	if r.input != nil && !r.input.MatchString(ev.Input) {
+		return false
+	}
+	if r.cwd != nil && !r.cwd.MatchString(ev.Cwd) {
+		return false
+	}
+	if r.MinDuration > 0 || r.MaxDuration > 0 {
+		if ev.Duration <= 0 {
+			return false
+		}
+		if r.MinDuration > 0 && ev.Duration < time.Duration(r.MinDuration) {
+			return false
+		}
+		if r.MaxDuration > 0 && ev.Duration >= time.Duration(r.MaxDuration) {
+			return false
+		}
+	}
+	return true
+}
+
+// globRegexp converts a path glob to an anchored regular expression.
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	// Runes rather than bytes, so that non-ASCII paths are quoted whole.
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const sampleRules = `
+rules:
+  - event: PermissionRequest
+    tool: Read
+    action: drop
+  - event: Stop
+    max_duration: 30s
+    action: drop
+  - event: PermissionRequest
+    tool: Bash
+    input: '^git push'
+    action: notify
+  - event: PermissionRequest
+    tool: Bash
+    action: silent
+  - cwd: /home/me/scratch/**
+    action: silent
+  - cwd: /home/日本/*/tmp?
+    action: drop
+`
+
+func TestEvaluate(t *testing.T) {
+	s, err := Parse([]byte(sampleRules))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ev   Event
+		want Action
+	}{
+		{"drops Read permission", Event{Name: "PermissionRequest", Tool: "Read"}, Drop},
+		{"drops short turn", Event{Name: "Stop", Duration: 10 * time.Second}, Drop},
+		{"notifies long turn", Event{Name: "Stop", Duration: time.Minute}, Notify},
+		{"notifies turn of unknown length", Event{Name: "Stop"}, Notify},
+		{"notifies matching Bash command", Event{Name: "PermissionRequest", Tool: "Bash", Input: "git push origin main"}, Notify},
+		{"silences other Bash commands", Event{Name: "PermissionRequest", Tool: "Bash", Input: "ls"}, Silent},
+		{"silences nested scratch dir", Event{Name: "Stop", Cwd: "/home/me/scratch/a/b", Duration: time.Hour}, Silent},
+		{"ignores sibling dir", Event{Name: "Stop", Cwd: "/home/me/scratchpad", Duration: time.Hour}, Notify},
+		{"matches non-ASCII dir", Event{Name: "Stop", Cwd: "/home/日本/プロジェクト/tmp1", Duration: time.Hour}, Drop},
+		{"non-ASCII star stops at slash", Event{Name: "Stop", Cwd: "/home/日本/a/b/tmp1", Duration: time.Hour}, Notify},
+		{"notifies unmatched event", Event{Name: "Notification"}, Notify},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Evaluate(tt.ev); got != tt.want {
+				t.Errorf("Evaluate(%+v) = %q, want %q", tt.ev, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateNilSet(t *testing.T) {
+	var s *Set
+	if got := s.Evaluate(Event{Name: "Stop"}); got != Notify {
+		t.Errorf("Evaluate = %q, want %q", got, Notify)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"unknown action", "rules:\n  - event: Stop\n    action: shout\n"},
+		{"missing action", "rules:\n  - event: Stop\n"},
+		{"invalid regexp", "rules:\n  - input: '('\n    action: drop\n"},
+		{"invalid duration", "rules:\n  - max_duration: soon\n    action: drop\n"},
+		{"inverted durations", "rules:\n  - min_duration: 1m\n    max_duration: 30s\n    action: drop\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.yaml)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	os.WriteFile(path, []byte(sampleRules), 0644)
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(s.Rules); n != 6 {
+		t.Errorf("rules = %d, want 6", n)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for missing file, got nil")
+	}
+}
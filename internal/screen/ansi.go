@@ -0,0 +1,232 @@
+package screen
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// cell is one character cell of a terminal screen.
+type cell struct {
+	Rune      rune
+	FG, BG    color.RGBA
+	Bold      bool
+	Underline bool
+	// Wide cells take two columns; the second one is a cell with no rune.
+	Wide bool
+}
+
+// Default colours of text without colour attributes.
+var (
+	defaultFG = color.RGBA{0xd4, 0xd4, 0xd4, 0xff}
+	defaultBG = color.RGBA{0x1e, 0x1e, 0x1e, 0xff}
+)
+
+// palette is the xterm palette of the 16 basic colours.
+var palette = [16]color.RGBA{
+	{0x00, 0x00, 0x00, 0xff}, {0xcd, 0x31, 0x31, 0xff}, {0x0d, 0xbc, 0x79, 0xff}, {0xe5, 0xe5, 0x10, 0xff},
+	{0x24, 0x72, 0xc8, 0xff}, {0xbc, 0x3f, 0xbc, 0xff}, {0x11, 0xa8, 0xcd, 0xff}, {0xe5, 0xe5, 0xe5, 0xff},
+	{0x66, 0x66, 0x66, 0xff}, {0xf1, 0x4c, 0x4c, 0xff}, {0x23, 0xd1, 0x8b, 0xff}, {0xf5, 0xf5, 0x43, 0xff},
+	{0x3b, 0x8e, 0xea, 0xff}, {0xd6, 0x70, 0xd6, 0xff}, {0x29, 0xb8, 0xdb, 0xff}, {0xff, 0xff, 0xff, 0xff},
+}
+
+// color256 returns colour n of the xterm 256 colour palette.
+func color256(n int) color.RGBA {
+	switch {
+	case n < 16:
+		return palette[n]
+	case n < 232:
+		n -= 16
+		levels := [6]uint8{0, 95, 135, 175, 215, 255}
+		return color.RGBA{levels[n/36], levels[n/6%6], levels[n%6], 0xff}
+	default:
+		g := uint8(8 + 10*(n-232))
+		return color.RGBA{g, g, g, 0xff}
+	}
+}
+
+// style is the graphic rendition set by SGR escape sequences.
+type style struct {
+	fg, bg               *color.RGBA
+	bold, dim, underline bool
+	reverse              bool
+}
+
+func (s style) cell(r rune) cell {
+	fg, bg := defaultFG, defaultBG
+	if s.fg != nil {
+		fg = *s.fg
+	}
+	if s.bg != nil {
+		bg = *s.bg
+	}
+	if s.reverse {
+		fg, bg = bg, fg
+	}
+	if s.dim {
+		fg = blend(fg, bg)
+	}
+	return cell{Rune: r, FG: fg, BG: bg, Bold: s.bold, Underline: s.underline}
+}
+
+func blend(a, b color.RGBA) color.RGBA {
+	return color.RGBA{uint8((int(a.R) + int(b.R)) / 2), uint8((int(a.G) + int(b.G)) / 2), uint8((int(a.B) + int(b.B)) / 2), 0xff}
+}
+
+// apply updates s with the parameters of an SGR sequence.
+func (s *style) apply(params string) {
+	var p []int
+	for _, f := range strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' }) {
+		n, _ := strconv.Atoi(f)
+		p = append(p, n)
+	}
+	if len(p) == 0 {
+		p = []int{0}
+	}
+	for i := 0; i < len(p); i++ {
+		switch n := p[i]; {
+		case n == 0:
+			*s = style{}
+		case n == 1:
+			s.bold = true
+		case n == 2:
+			s.dim = true
+		case n == 4:
+			s.underline = true
+		case n == 7:
+			s.reverse = true
+		case n == 22:
+			s.bold, s.dim = false, false
+		case n == 24:
+			s.underline = false
+		case n == 27:
+			s.reverse = false
+		case n >= 30 && n <= 37:
+			s.fg = ptr(palette[n-30])
+		case n >= 90 && n <= 97:
+			s.fg = ptr(palette[n-90+8])
+		case n == 39:
+			s.fg = nil
+		case n >= 40 && n <= 47:
+			s.bg = ptr(palette[n-40])
+		case n >= 100 && n <= 107:
+			s.bg = ptr(palette[n-100+8])
+		case n == 49:
+			s.bg = nil
+		case n == 38 || n == 48:
+			c, used := extended(p[i+1:])
+			i += used
+			if c == nil {
+				continue
+			}
+			if n == 38 {
+				s.fg = c
+			} else {
+				s.bg = c
+			}
+		}
+	}
+}
+
+// extended parses the colour of a 38 or 48 SGR parameter: 5;n for the
+// 256 colour palette or 2;r;g;b for true colour. It returns the colour
+// and the number of parameters used.
+func extended(p []int) (*color.RGBA, int) {
+	switch {
+	case len(p) >= 2 && p[0] == 5:
+		return ptr(color256(min(max(p[1], 0), 255))), 2
+	case len(p) >= 4 && p[0] == 2:
+		return ptr(color.RGBA{uint8(p[1]), uint8(p[2]), uint8(p[3]), 0xff}), 4
+	}
+	return nil, len(p)
+}
+
+func ptr(c color.RGBA) *color.RGBA { return &c }
+
+// tabWidth is the distance between tab stops.
+const tabWidth = 8
+
+// parse reads a capture with escape sequences, as taken by tmux
+// capture-pane -e, into rows of cells. Colours and attributes carry over
+// from one line to the next, as in a terminal. Blank rows at the start
+// and end are dropped.
+func parse(capture string) [][]cell {
+	var (
+		rows [][]cell
+		s    style
+	)
+	for _, line := range strings.Split(capture, "\n") {
+		var row []cell
+		runes := []rune(line)
+		for i := 0; i < len(runes); i++ {
+			r := runes[i]
+			switch {
+			case r == 0x1b && i+1 < len(runes) && runes[i+1] == '[':
+				j := i + 2
+				for j < len(runes) && (runes[j] < 0x40 || runes[j] > 0x7e) {
+					j++
+				}
+				if j < len(runes) && runes[j] == 'm' {
+					s.apply(string(runes[i+2 : j]))
+				}
+				i = j
+			case r == 0x1b && i+1 < len(runes) && runes[i+1] == ']':
+				j := i + 2
+				for j < len(runes) && runes[j] != 0x07 && !(runes[j] == 0x1b && j+1 < len(runes) && runes[j+1] == '\\') {
+					j++
+				}
+				if j < len(runes) && runes[j] == 0x1b {
+					j++
+				}
+				i = j
+			case r == 0x1b:
+				i++
+			case r == '\t':
+				for n := tabWidth - len(row)%tabWidth; n > 0; n-- {
+					row = append(row, s.cell(' '))
+				}
+			case r < ' ' || r == 0x7f:
+			case isWide(r):
+				c := s.cell(r)
+				c.Wide = true
+				row = append(row, c, s.cell(0))
+			default:
+				row = append(row, s.cell(r))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	for len(rows) > 0 && blankRow(rows[0]) {
+		rows = rows[1:]
+	}
+	for len(rows) > 0 && blankRow(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	return rows
+}
+
+// blankRow reports whether row shows nothing but the default background.
+func blankRow(row []cell) bool {
+	for _, c := range row {
+		if c.Rune != ' ' && c.Rune != 0 || c.BG != defaultBG {
+			return false
+		}
+	}
+	return true
+}
+
+// isWide reports whether r takes two columns in a terminal, as East Asian
+// wide characters and most emoji do.
+func isWide(r rune) bool {
+	switch {
+	case r < 0x1100:
+		return false
+	case r <= 0x115f, r >= 0x2e80 && r <= 0xa4cf && r != 0x303f, r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff, r >= 0xfe30 && r <= 0xfe4f, r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6, r >= 0x1f300 && r <= 0x1f64f, r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package screen
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/tmux"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// fontSize is the font size in pixels.
+	fontSize = 16
+	// padding surrounds the screen in pixels.
+	padding = 12
+	// maxColumns and maxRows bound the size of an image.
+	maxColumns = 300
+	maxRows    = 200
+)
+
+// substitutes replace characters Go Mono has no glyph for, many of which
+// Claude Code draws, with similar ones it has.
+var substitutes = map[rune]rune{
+	'❯': '>', '▶': '►', '▸': '►', '⏵': '►',
+	'⏺': '●', '◆': '●', '✻': '*', '✶': '*', '✳': '*', '✢': '*', '✽': '*',
+	'✓': '√', '✔': '√', '✗': '×', '✘': '×',
+	'⚠': '!', '⇅': '↕', '⏸': '|',
+}
+
+// Sides of a cell that a box drawing character connects.
+const (
+	up = 1 << iota
+	down
+	left
+	right
+)
+
+// boxes are the box drawing characters drawn as lines rather than with
+// the font, so that they join across cells. Go Mono's glyphs fall short
+// of the cell height, and it lacks the rounded corners.
+var boxes = map[rune]int{
+	'─': left | right, '━': left | right, '│': up | down, '┃': up | down,
+	'┌': down | right, '╭': down | right, '┐': down | left, '╮': down | left,
+	'└': up | right, '╰': up | right, '┘': up | left, '╯': up | left,
+	'├': up | down | right, '┤': up | down | left,
+	'┬': down | left | right, '┴': up | left | right, '┼': up | down | left | right,
+	// Claude Code prefixes tool output with ⎿.
+	'⎿': up | right,
+}
+
+// drawBox draws the lines of box drawing character sides in rect.
+func drawBox(img draw.Image, rect image.Rectangle, sides int, c image.Image) {
+	cx, cy := (rect.Min.X+rect.Max.X)/2, (rect.Min.Y+rect.Max.Y)/2
+	if sides&up != 0 {
+		draw.Draw(img, image.Rect(cx, rect.Min.Y, cx+1, cy+1), c, image.Point{}, draw.Src)
+	}
+	if sides&down != 0 {
+		draw.Draw(img, image.Rect(cx, cy, cx+1, rect.Max.Y), c, image.Point{}, draw.Src)
+	}
+	if sides&left != 0 {
+		draw.Draw(img, image.Rect(rect.Min.X, cy, cx+1, cy+1), c, image.Point{}, draw.Src)
+	}
+	if sides&right != 0 {
+		draw.Draw(img, image.Rect(cx, cy, rect.Max.X, cy+1), c, image.Point{}, draw.Src)
+	}
+}
+
+// faces are the regular and bold faces of Go Mono, which is embedded in
+// the binary so that rendering does not depend on installed fonts.
+var faces = sync.OnceValues(func() ([2]font.Face, error) {
+	var faces [2]font.Face
+	for i, ttf := range [][]byte{gomono.TTF, gomonobold.TTF} {
+		f, err := opentype.Parse(ttf)
+		if err != nil {
+			return faces, fmt.Errorf("parse font: %w", err)
+		}
+		faces[i], err = opentype.NewFace(f, &opentype.FaceOptions{Size: fontSize, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return faces, fmt.Errorf("load font: %w", err)
+		}
+	}
+	return faces, nil
+})
+
+// PNG renders a capture taken with escape sequences as a PNG image of the
+// terminal, with its colours, bold and underlined text, and secrets masked
+// by r. Every character is drawn in its own cell, so columns and box
+// drawing stay aligned.
+func PNG(capture string, r *redact.Redactor) ([]byte, error) {
+	faces, err := faces()
+	if err != nil {
+		return nil, err
+	}
+	rows := parse(capture)
+	mask(rows, r)
+	if len(rows) > maxRows {
+		rows = rows[len(rows)-maxRows:]
+	}
+	columns := 1
+	for _, row := range rows {
+		columns = max(columns, min(len(row), maxColumns))
+	}
+
+	m := faces[0].Metrics()
+	advance, _ := faces[0].GlyphAdvance('0')
+	cw, ch := advance.Ceil(), m.Height.Ceil()
+	ascent := m.Ascent.Ceil()
+
+	img := image.NewRGBA(image.Rect(0, 0, columns*cw+2*padding, max(len(rows), 1)*ch+2*padding))
+	draw.Draw(img, img.Bounds(), image.NewUniform(defaultBG), image.Point{}, draw.Src)
+	for y, row := range rows {
+		for x, c := range row {
+			if x >= maxColumns {
+				break
+			}
+			w := cw
+			if c.Wide {
+				w = 2 * cw
+			}
+			px, py := padding+x*cw, padding+y*ch
+			if c.BG != defaultBG {
+				draw.Draw(img, image.Rect(px, py, px+w, py+ch), image.NewUniform(c.BG), image.Point{}, draw.Src)
+			}
+			if c.Underline {
+				draw.Draw(img, image.Rect(px, py+ch-2, px+w, py+ch-1), image.NewUniform(c.FG), image.Point{}, draw.Src)
+			}
+			if c.Rune == 0 || c.Rune == ' ' {
+				continue
+			}
+			if sides, ok := boxes[c.Rune]; ok {
+				drawBox(img, image.Rect(px, py, px+w, py+ch), sides, image.NewUniform(c.FG))
+				continue
+			}
+			face := faces[0]
+			if c.Bold {
+				face = faces[1]
+			}
+			d := font.Drawer{Dst: img, Src: image.NewUniform(c.FG), Face: face, Dot: fixed.P(px, py+ascent)}
+			r := c.Rune
+			if sub, ok := substitutes[r]; ok {
+				r = sub
+			}
+			d.DrawString(string(r))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Screenshot captures the visible screen of the tmux target pane, masks
+// secrets with r and renders it as a PNG image.
+func Screenshot(target string, r *redact.Redactor) ([]byte, error) {
+	capture, err := tmux.CapturePane(target, tmux.CaptureOptions{Escapes: true})
+	if err != nil {
+		return nil, err
+	}
+	return PNG(capture, r)
+}
+
+// mask replaces the secrets r finds in rows with [REDACTED:<name>] marks,
+// or with asterisks where the mark does not fit, keeping the colours of
+// the cells. It searches the text of the rows, after escape sequences are
+// gone, and joins rows that fill the screen width with the next one, so
+// that a secret wrapped at the edge of the pane is found too.
+func mask(rows [][]cell, r *redact.Redactor) {
+	type pos struct{ row, col int }
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	var (
+		text []byte
+		// at is the cell of each byte of text; newlines have none.
+		at []pos
+	)
+	for y, row := range rows {
+		for x, c := range row {
+			// The second half of a wide character has no rune of its own.
+			if c.Rune == 0 {
+				continue
+			}
+			n := len(text)
+			text = utf8.AppendRune(text, c.Rune)
+			for range len(text) - n {
+				at = append(at, pos{y, x})
+			}
+		}
+		if len(row) < width {
+			text = append(text, '\n')
+			at = append(at, pos{-1, -1})
+		}
+	}
+
+	for _, secret := range r.Find(string(text)) {
+		var cells []*cell
+		last := pos{-1, -1}
+		for _, p := range at[secret.Start:secret.End] {
+			if p.row < 0 || p == last {
+				continue
+			}
+			last = p
+			cells = append(cells, &rows[p.row][p.col])
+			if rows[p.row][p.col].Wide {
+				cells = append(cells, &rows[p.row][p.col+1])
+			}
+		}
+		mark := []rune("[REDACTED:" + secret.Name + "]")
+		if len(mark) > len(cells) {
+			mark = nil
+		}
+		for i, c := range cells {
+			c.Rune, c.Wide = '*', false
+			if i < len(mark) {
+				c.Rune = mark[i]
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package screen
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiRe matches terminal escape sequences: CSI sequences such as colours
+// and cursor movement, OSC sequences such as window titles and
+// hyperlinks, and other two-character escapes.
+var ansiRe = regexp.MustCompile(`\x1b\[[0-9;?<=>!]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// Strip removes escape sequences and other control characters except
+// newlines and tabs from s.
+func Strip(s string) string {
+	s = ansiRe.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\n' && r != '\t' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Tail returns the last n lines of s that remain after trimming trailing
+// spaces from each line, dropping leading and trailing blank lines and
+// collapsing runs of blank lines into one.
+func Tail(s string, n int) []string {
+	var lines []string
+	blank := false
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimRight(l, " \t\r")
+		if l == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, l)
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
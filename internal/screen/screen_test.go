@@ -0,0 +1,157 @@
+package screen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/nktks/cc-slack/internal/redact"
+)
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"colours", "\x1b[1;32m✓\x1b[0m ok", "✓ ok"},
+		{"cursor", "\x1b[?25l\x1b[2Kdone\x1b[?25h", "done"},
+		{"hyperlink", "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"title", "\x1b]0;claude\x07prompt", "prompt"},
+		{"control characters", "a\rb\x08c\td\n", "abc\td\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Strip(tt.in); got != tt.want {
+				t.Errorf("Strip(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTail(t *testing.T) {
+	in := "\n\n  \nfirst   \nsecond\n\n\n\nthird\n\n  \n"
+	if got, want := strings.Join(Tail(in, 0), "|"), "first|second||third"; got != want {
+		t.Errorf("Tail(0) = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(Tail(in, 2), "|"), "|third"; got != want {
+		t.Errorf("Tail(2) = %q, want %q", got, want)
+	}
+	if got := Tail(" \n\n", 10); len(got) != 0 {
+		t.Errorf("Tail(blank) = %q, want none", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	rows := parse("\n\x1b[1;31mred\x1b[0m \x1b[48;5;21mb\x1b[38;2;1;2;3mx\n\x1b[7mr\x1b[27m\t|日\n\n")
+	if len(rows) != 2 {
+		t.Fatalf("rows = %d, want 2", len(rows))
+	}
+
+	red := rows[0][0]
+	if red.Rune != 'r' || !red.Bold || red.FG != palette[1] || red.BG != defaultBG {
+		t.Errorf("red = %+v", red)
+	}
+	if c := rows[0][3]; c.Rune != ' ' || c.Bold || c.FG != defaultFG {
+		t.Errorf("reset = %+v", c)
+	}
+	if c := rows[0][4]; c.BG != color256(21) {
+		t.Errorf("256 colour background = %+v", c)
+	}
+	// Attributes carry over to the next cell and line.
+	if c := rows[0][5]; c.FG != (color.RGBA{1, 2, 3, 0xff}) || c.BG != color256(21) {
+		t.Errorf("true colour = %+v", c)
+	}
+
+	if c := rows[1][0]; c.FG != color256(21) || c.BG != (color.RGBA{1, 2, 3, 0xff}) {
+		t.Errorf("reverse = %+v", c)
+	}
+	if len(rows[1]) != 11 || rows[1][8].Rune != '|' {
+		t.Errorf("tab should expand to column 8, got %d cells", len(rows[1]))
+	}
+	if c := rows[1][9]; c.Rune != '日' || !c.Wide || rows[1][10].Rune != 0 {
+		t.Errorf("wide = %+v", c)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	data, err := PNG("\x1b[32m╭──╮\x1b[0m\n│ok│ ❯ ✻\n╰──╯", redact.Default)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid png: %v", err)
+	}
+	faces, _ := faces()
+	advance, _ := faces[0].GlyphAdvance('0')
+	cw, ch := advance.Ceil(), faces[0].Metrics().Height.Ceil()
+	want := image.Rect(0, 0, 8*cw+2*padding, 3*ch+2*padding)
+	if img.Bounds() != want {
+		t.Errorf("bounds = %v, want %v", img.Bounds(), want)
+	}
+	// The top border is drawn across the whole cell, in green.
+	y := padding + ch/2
+	for _, x := range []int{padding + cw, padding + 2*cw - 1} {
+		if got := color.RGBAModel.Convert(img.At(x, y)); got != palette[2] {
+			t.Errorf("border at %d,%d = %v, want %v", x, y, got, palette[2])
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	token := "ghp_" + strings.Repeat("A", 36)
+	tests := []struct {
+		name    string
+		capture string
+		want    []string
+	}{
+		{
+			"coloured assignment",
+			"$ export GITHUB_TOKEN\x1b[0m=\x1b[32m" + token + "\x1b[0m",
+			[]string{"$ export GITHUB_TOKEN=[REDACTED:github-token]" + strings.Repeat("*", 17)},
+		},
+		{
+			"wrapped at the pane edge",
+			"$ echo " + token[:33] + "\n" + token[33:] + "\nok",
+			[]string{"$ echo [REDACTED:github-token]" + strings.Repeat("*", 10), strings.Repeat("*", 7), "ok"},
+		},
+		{
+			"mark does not fit",
+			"\x1b[1mpassword=\x1b[31mhunter22\x1b[0m",
+			[]string{"password=********"},
+		},
+		{
+			"no secret",
+			"$ go test ./...\nok",
+			[]string{"$ go test ./...", "ok"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := parse(tt.capture)
+			mask(rows, redact.Default)
+			var got []string
+			for _, row := range rows {
+				var b strings.Builder
+				for _, c := range row {
+					b.WriteRune(c.Rune)
+				}
+				got = append(got, b.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("masked = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Masked cells keep their colours.
+	rows := parse("TOKEN=\x1b[32m" + token)
+	mask(rows, redact.Default)
+	if c := rows[0][6]; c.Rune != '[' || c.FG != palette[2] {
+		t.Errorf("masked cell = %+v, want a green mark", c)
+	}
+}
@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// commandTimeout bounds how long a secret store command may run.
+const commandTimeout = 30 * time.Second
+
+// Lookup returns the value of the environment variable name. When it is
+// unset, the value is read from the first of these that is configured:
+//
+//   - the file named by name_FILE
+//   - the systemd credential called name in $CREDENTIALS_DIRECTORY
+//   - the freedesktop Secret Service item matching the attributes in
+//     name_SECRET_SERVICE, such as "service cc-slack account bot"
+//   - the standard output of the shell command in name_COMMAND, such as
+//     "pass show slack/bot" or "gopass show -o slack/bot"
+//
+// Surrounding whitespace is trimmed. Lookup returns an empty string if no
+// source is configured. Errors never contain the secret itself.
+func Lookup(name string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return readFile(name+"_FILE", path)
+	}
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return readFile("systemd credential "+name, path)
+		}
+	}
+	if attrs := os.Getenv(name + "_SECRET_SERVICE"); attrs != "" {
+		fields := strings.Fields(attrs)
+		if len(fields) == 0 || len(fields)%2 != 0 {
+			return "", fmt.Errorf("%s_SECRET_SERVICE: want attribute and value pairs, got %d words", name, len(fields))
+		}
+		return run(name+"_SECRET_SERVICE", "secret-tool", append([]string{"lookup"}, fields...)...)
+	}
+	if command := os.Getenv(name + "_COMMAND"); command != "" {
+		return run(name+"_COMMAND", "sh", "-c", command)
+	}
+	return "", nil
+}
+
+// LookupWithFallback returns Lookup(primary), or Lookup(fallback) if no
+// source is configured for primary.
+func LookupWithFallback(primary, fallback string) (string, error) {
+	v, err := Lookup(primary)
+	if err != nil || v != "" {
+		return v, err
+	}
+	return Lookup(fallback)
+}
+
+func readFile(source, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", source, err)
+	}
+	v := strings.TrimSpace(string(data))
+	if v == "" {
+		return "", fmt.Errorf("%s: %s is empty", source, path)
+	}
+	return v, nil
+}
+
+func run(source, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", source, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", source, err)
+	}
+	// pass and gopass print the secret on the first line, followed by
+	// optional metadata.
+	v, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return "", fmt.Errorf("%s: %w", source, errEmptyOutput)
+	}
+	return v, nil
+}
+
+var errEmptyOutput = errors.New("command printed nothing")
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// recentPost is the last message posted for a session, which later events
+// inside the coalesce window update instead of posting anew. The window
+// runs from the last post or update, so it slides along a steady burst.
+type recentPost struct {
+	Channel   string
+	TS        string
+	Reply     bool
+	UpdatedAt time.Time
+	Events    int
+}
+
+// recentPosts tracks the last post per session. The zero value is ready to use.
+type recentPosts struct {
+	mu    sync.Mutex
+	posts map[string]recentPost
+}
+
+// Get returns the post for sessionID if it was made or updated within window.
+func (r *recentPosts) Get(sessionID string, window time.Duration) (recentPost, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.posts[sessionID]
+	if !ok || time.Since(p.UpdatedAt) >= window {
+		return recentPost{}, false
+	}
+	return p, true
+}
+
+// Set records p for sessionID and drops posts older than window.
+func (r *recentPosts) Set(sessionID string, p recentPost, window time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.posts == nil {
+		r.posts = make(map[string]recentPost)
+	}
+	for id, old := range r.posts {
+		if time.Since(old.UpdatedAt) >= window {
+			delete(r.posts, id)
+		}
+	}
+	r.posts[sessionID] = p
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/slack"
+)
+
+// OutboxEntry is a notification waiting to be delivered to Slack.
+type OutboxEntry struct {
+	ID         int64        `json:"id"`
+	SessionID  string       `json:"session_id,omitempty"`
+	Event      string       `json:"event"`
+	Channel    string       `json:"channel"`
+	Mention    string       `json:"mention,omitempty"`
+	Text       string       `json:"text"`
+	Blocks     slack.Blocks `json:"blocks,omitempty"`
+	ThreadTS   string       `json:"thread_ts,omitempty"`
+	Reply      bool         `json:"reply,omitempty"`
+	TmuxTarget string       `json:"tmux_target,omitempty"`
+	Owner      string       `json:"owner,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// Outbox is an on-disk FIFO of notifications that could not be posted.
+// Every change is written to disk before the method returns.
+type Outbox struct {
+	path string
+
+	mu      sync.Mutex
+	entries []OutboxEntry
+	nextID  int64
+
+	// flushing guards against concurrent flushes reordering deliveries.
+	flushing sync.Mutex
+}
+
+// lockFlush waits until no other flush is running and locks flushing,
+// or returns the error of ctx.
+func (o *Outbox) lockFlush(ctx context.Context) error {
+	for !o.flushing.TryLock() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// OpenOutbox loads the outbox stored at path, creating an empty one if the
+// file does not exist yet.
+func OpenOutbox(path string) (*Outbox, error) {
+	o := &Outbox{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read outbox: %w", err)
+	}
+	if err := json.Unmarshal(data, &o.entries); err != nil {
+		return nil, fmt.Errorf("parse outbox %s: %w", path, err)
+	}
+	for _, e := range o.entries {
+		if e.ID >= o.nextID {
+			o.nextID = e.ID + 1
+		}
+	}
+	return o, nil
+}
+
+// Add appends an entry to the outbox.
+func (o *Outbox) Add(e OutboxEntry) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e.ID = o.nextID
+	o.nextID++
+	o.entries = append(o.entries, e)
+	return o.save()
+}
+
+// Remove deletes the entry with the given ID.
+func (o *Outbox) Remove(id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, e := range o.entries {
+		if e.ID == id {
+			o.entries = append(o.entries[:i], o.entries[i+1:]...)
+			return o.save()
+		}
+	}
+	return nil
+}
+
+// Entries returns a copy of the pending entries in delivery order.
+func (o *Outbox) Entries() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutboxEntry(nil), o.entries...)
+}
+
+// HasSession reports whether any entry for sessionID is still pending.
+func (o *Outbox) HasSession(sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, e := range o.entries {
+		if e.SessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of pending entries.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// save writes the entries atomically, so a crash never leaves a
+// half-written outbox.
+func (o *Outbox) save() error {
+	data, err := json.MarshalIndent(o.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode outbox: %w", err)
+	}
+	return writeFileAtomic(o.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path,
+// creating the parent directory if needed.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	t.Run("open returns empty outbox for missing file", func(t *testing.T) {
+		o, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := o.Len(); n != 0 {
+			t.Errorf("len = %d, want 0", n)
+		}
+	})
+
+	t.Run("entries survive reopen in order", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nested", "outbox.json")
+		o, err := OpenOutbox(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		o.Add(OutboxEntry{SessionID: "sess-1", Text: "first", CreatedAt: time.Now()})
+		o.Add(OutboxEntry{SessionID: "sess-1", Text: "second", Reply: true, CreatedAt: time.Now()})
+
+		reopened, err := OpenOutbox(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		entries := reopened.Entries()
+		if len(entries) != 2 {
+			t.Fatalf("len = %d, want 2", len(entries))
+		}
+		if entries[0].Text != "first" || entries[1].Text != "second" {
+			t.Errorf("entries = %q, %q, want first, second", entries[0].Text, entries[1].Text)
+		}
+
+		reopened.Add(OutboxEntry{Text: "third"})
+		if id := reopened.Entries()[2].ID; id != 2 {
+			t.Errorf("new entry id = %d, want 2", id)
+		}
+	})
+
+	t.Run("remove deletes the entry", func(t *testing.T) {
+		o, _ := OpenOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+		o.Add(OutboxEntry{SessionID: "sess-1"})
+		o.Add(OutboxEntry{SessionID: "sess-2"})
+
+		o.Remove(o.Entries()[0].ID)
+
+		if o.HasSession("sess-1") {
+			t.Error("sess-1 should be removed")
+		}
+		if !o.HasSession("sess-2") {
+			t.Error("sess-2 should remain")
+		}
+	})
+
+	t.Run("has session ignores empty session ID", func(t *testing.T) {
+		o, _ := OpenOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+		o.Add(OutboxEntry{})
+		if o.HasSession("") {
+			t.Error("empty session ID should never match")
+		}
+	})
+
+	t.Run("open fails on corrupt file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		os.WriteFile(path, []byte("not json"), 0600)
+		if _, err := OpenOutbox(path); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
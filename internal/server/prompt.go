@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/answer"
+	"github.com/nktks/cc-slack/internal/hook"
+	"github.com/nktks/cc-slack/internal/logging"
+	"github.com/nktks/cc-slack/internal/metrics"
+	"github.com/nktks/cc-slack/internal/render"
+	"github.com/nktks/cc-slack/internal/slack"
+)
+
+// sentMessage is a notification as it was posted to Slack.
+type sentMessage struct {
+	Channel string
+	TS      string
+	Message slack.Message
+}
+
+// trackPrompt records whether the session is waiting on a permission
+// prompt, so the bot knows which replies are answers to it. Any other
+// event except Notification means the pending prompt was answered; if
+// that did not happen in Slack, it was answered at the terminal.
+func (h *Handler) trackPrompt(input hook.Input, sent sentMessage) {
+	if input.HookEventName == "Notification" {
+		// Notifications accompany prompts rather than resolve them.
+		return
+	}
+	if p := h.Threads.TakePending(input.SessionID); p != nil {
+		// An event coalesced into the prompt's message already replaced it.
+		if p.TS == sent.TS {
+			p.TS = ""
+		}
+		h.resolve(p, "", "")
+	}
+	if input.HookEventName == "PermissionRequest" {
+		p := &Prompt{
+			Tool:     input.ToolName,
+			PostedAt: time.Now(),
+			Options:  render.Options(input),
+			Channel:  sent.Channel,
+			TS:       sent.TS,
+			Message:  sent.Message,
+		}
+		if input.ToolName == "AskUserQuestion" {
+			p.Questions = answer.Questions(input.ToolInput)
+		}
+		h.Threads.SetPending(input.SessionID, p)
+	}
+}
+
+// ResolvePrompt marks the prompt pending in the thread threadTS of channel
+// as answered in Slack by user. answer is the number or label of the
+// chosen option, or the text typed for it, which is redacted before it is
+// shown.
+func (h *Handler) ResolvePrompt(channel, threadTS, user, answer string) {
+	sessionID, ok := h.Threads.SessionByThreadTS(channel, threadTS)
+	if !ok {
+		return
+	}
+	if p := h.Threads.TakePending(sessionID); p != nil {
+		h.resolve(p, user, h.settings().Redactor.String(answer))
+	}
+}
+
+// resolve edits the message of prompt p to show how it was answered and
+// removes its buttons. An empty user means it was answered at the terminal.
+func (h *Handler) resolve(p *Prompt, user, answer string) {
+	metrics.PermissionWaited(p.Tool, time.Since(p.PostedAt))
+	if p.TS == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postTimeout)
+	defer cancel()
+	if err := h.Slack.UpdateMessage(ctx, p.Channel, p.TS, render.Resolved(p.Message, resolution(p, user, answer))); err != nil {
+		slog.Warn("failed to mark prompt as resolved", logging.Channel, p.Channel, "ts", p.TS, "error", err)
+	}
+}
+
+// resolution describes how p was answered.
+func resolution(p *Prompt, user, answer string) string {
+	if user == "" {
+		return "✅ Resolved at terminal"
+	}
+	by := fmt.Sprintf("by <@%s> via Slack", user)
+	label := answer
+	if n, err := strconv.Atoi(answer); err == nil {
+		label = "option " + answer
+		if n >= 1 && n <= len(p.Options) {
+			label = p.Options[n-1]
+		}
+	}
+	switch {
+	case p.Tool == "AskUserQuestion":
+		return fmt.Sprintf("✅ Answered %s: %s", by, label)
+	case strings.HasPrefix(label, "No"):
+		return "❌ Denied " + by
+	default:
+		return fmt.Sprintf("✅ Approved %s: %s", by, label)
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+import "testing"
+
+func TestResolution(t *testing.T) {
+	bash := &Prompt{Tool: "Bash", Options: []string{"Yes", "Yes, and don't ask again for this session", "No"}}
+	question := &Prompt{Tool: "AskUserQuestion", Options: []string{"Postgres", "SQLite"}}
+
+	tests := []struct {
+		name   string
+		prompt *Prompt
+		user   string
+		answer string
+		want   string
+	}{
+		{"terminal", bash, "", "", "✅ Resolved at terminal"},
+		{"approved", bash, "U1", "1", "✅ Approved by <@U1> via Slack: Yes"},
+		{"denied", bash, "U1", "3", "❌ Denied by <@U1> via Slack"},
+		{"question", question, "U2", "2", "✅ Answered by <@U2> via Slack: SQLite"},
+		{"unlisted option", question, "U2", "3", "✅ Answered by <@U2> via Slack: option 3"},
+		{"label", bash, "U1", "Yes, and don't ask again for this session", "✅ Approved by <@U1> via Slack: Yes, and don't ask again for this session"},
+		{"typed answer", question, "U2", "MySQL", "✅ Answered by <@U2> via Slack: MySQL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolution(tt.prompt, tt.user, tt.answer); got != tt.want {
+				t.Errorf("resolution() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
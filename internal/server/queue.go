@@ -0,0 +1,72 @@
+package server
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// Queue runs jobs on a fixed pool of workers. Jobs that share a key are
+// always dispatched to the same worker, so they run in submission order.
+type Queue struct {
+	workers []chan func()
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue starts a queue with the given number of workers, each buffering
+// up to size pending jobs.
+func NewQueue(workers, size int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{workers: make([]chan func(), workers)}
+	for i := range q.workers {
+		ch := make(chan func(), size)
+		q.workers[i] = ch
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for job := range ch {
+				job()
+			}
+		}()
+	}
+	return q
+}
+
+// Enqueue schedules job on the worker assigned to key.
+// It returns false if the worker's buffer is full or the queue is closed.
+func (q *Queue) Enqueue(key string, job func()) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.workers[q.shard(key)] <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting jobs and waits for pending jobs to finish.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		for _, ch := range q.workers {
+			close(ch)
+		}
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *Queue) shard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(q.workers)))
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("runs jobs with the same key in order", func(t *testing.T) {
+		q := NewQueue(4, 100)
+
+		var mu sync.Mutex
+		var got []int
+		for i := range 50 {
+			ok := q.Enqueue("sess-1", func() {
+				mu.Lock()
+				got = append(got, i)
+				mu.Unlock()
+			})
+			if !ok {
+				t.Fatalf("enqueue %d failed", i)
+			}
+		}
+		q.Close()
+
+		if len(got) != 50 {
+			t.Fatalf("ran %d jobs, want 50", len(got))
+		}
+		for i, v := range got {
+			if v != i {
+				t.Fatalf("job order = %v, want ascending", got)
+			}
+		}
+	})
+
+	t.Run("close waits for pending jobs", func(t *testing.T) {
+		q := NewQueue(2, 10)
+		var mu sync.Mutex
+		ran := 0
+		for _, key := range []string{"a", "b", "c", "d"} {
+			q.Enqueue(key, func() {
+				mu.Lock()
+				ran++
+				mu.Unlock()
+			})
+		}
+		q.Close()
+		if ran != 4 {
+			t.Errorf("ran = %d, want 4", ran)
+		}
+	})
+
+	t.Run("rejects jobs when buffer is full", func(t *testing.T) {
+		q := NewQueue(1, 1)
+		block := make(chan struct{})
+		started := make(chan struct{})
+		q.Enqueue("a", func() {
+			close(started)
+			<-block
+		})
+		<-started
+		if !q.Enqueue("a", func() {}) {
+			t.Fatal("second job should fit in the buffer")
+		}
+		if q.Enqueue("a", func() {}) {
+			t.Error("third job should be rejected")
+		}
+		close(block)
+		q.Close()
+	})
+
+	t.Run("rejects jobs after close", func(t *testing.T) {
+		q := NewQueue(1, 1)
+		q.Close()
+		if q.Enqueue("a", func() {}) {
+			t.Error("enqueue after close should fail")
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nktks/cc-slack/internal/logging"
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/screen"
+)
+
+// screenshotDelay gives Claude Code time to draw the permission dialog
+// before the terminal is captured.
+var screenshotDelay = time.Second
+
+// attachScreenshot uploads an image of the terminal pane target to the
+// thread threadTS, with secrets masked by r. It runs in the background so
+// that it does not hold up later events, and Drain waits for it.
+func (h *Handler) attachScreenshot(channel, threadTS, target string, r *redact.Redactor) {
+	capture := h.screenshot
+	if capture == nil {
+		capture = screen.Screenshot
+	}
+	h.goBackground(func() {
+		time.Sleep(screenshotDelay)
+		img, err := capture(target, r)
+		if err != nil {
+			slog.Warn("failed to take screenshot", logging.TmuxTarget, target, "error", err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), postTimeout)
+		defer cancel()
+		if err := h.Slack.UploadFile(ctx, channel, threadTS, "screen.png", "Terminal screen", img); err != nil {
+			slog.Warn("failed to upload screenshot", logging.Channel, channel, logging.ThreadTS, threadTS, "error", err)
+		}
+	})
+}
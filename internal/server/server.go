@@ -1,23 +1,192 @@
 package server
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nktks/cc-slack/internal/hook"
+	"github.com/nktks/cc-slack/internal/logging"
+	"github.com/nktks/cc-slack/internal/metrics"
+	"github.com/nktks/cc-slack/internal/redact"
+	"github.com/nktks/cc-slack/internal/render"
+	"github.com/nktks/cc-slack/internal/routing"
+	"github.com/nktks/cc-slack/internal/rules"
 	"github.com/nktks/cc-slack/internal/slack"
+	"github.com/nktks/cc-slack/internal/team"
+)
+
+const (
+	// postTimeout bounds the time spent posting one notification, including retries.
+	postTimeout = time.Minute
+	// defaultStaleAfter is used when Handler.StaleAfter is zero.
+	defaultStaleAfter = 10 * time.Minute
 )
 
 // Handler handles HTTP requests from Claude Code hooks.
 type Handler struct {
-	Slack         slack.Client
-	Channel       string
-	UserID string
-	Threads       *ThreadStore
+	Slack   slack.Client
+	Channel string
+	UserID  string
+	Threads *ThreadStore
+
+	// Queue processes events in the background. When nil, events are
+	// processed before HandleHook responds.
+	Queue *Queue
+
+	// Outbox stores notifications that could not be posted so they can be
+	// replayed by FlushOutbox. When nil, failed notifications are dropped.
+	Outbox *Outbox
+	// StaleAfter is the age after which a queued notification is delivered
+	// marked as stale. Defaults to 10 minutes.
+	StaleAfter time.Duration
+	// CoalesceWindow is how long after a post later events of the same
+	// session edit that message instead of posting new ones. Zero disables
+	// coalescing.
+	CoalesceWindow time.Duration
+	// Routes send matching sessions to other channels than Channel.
+	// Routes must be compiled.
+	Routes routing.Table
+	// Team maps the X-Cc-Slack-User identity to a Slack user. When set,
+	// the session owner is mentioned instead of UserID.
+	Team team.Directory
+	// Rules decide whether an event is posted with a mention, posted
+	// silently or dropped. When nil, every event is posted with a mention.
+	Rules *rules.Set
+	// Limits caps the length of message parts. Defaults to hook.DefaultLimits.
+	Limits hook.Limits
+	// Redactor removes secrets from messages before they are posted or
+	// queued. Defaults to redact.Default.
+	Redactor *redact.Redactor
+	// Templates customize the message text per event and tool. Events
+	// without a matching template use the default layout.
+	// Templates must be compiled.
+	Templates render.Set
+	// Blocks posts notifications as Block Kit messages, with the text as
+	// the fallback shown in push notifications.
+	Blocks bool
+	// Screenshots attaches an image of the session's terminal to the
+	// thread of each permission prompt, for sessions with a tmux target.
+	Screenshots bool
+
+	// screenshot captures a tmux pane as a PNG image. Defaults to
+	// screen.Screenshot; tests replace it.
+	screenshot func(target string, r *redact.Redactor) ([]byte, error)
+
+	// mu guards the fields that Apply changes at runtime.
+	mu       sync.RWMutex
+	sessions sessionLocks
+	recent   recentPosts
+	// background tracks the goroutines process leaves running, such as
+	// outbox flushes and screenshot uploads, so that Drain can wait for them.
+	background sync.WaitGroup
+}
+
+// Settings are the Handler options that can change while the server runs.
+type Settings struct {
+	Channel     string
+	UserID      string
+	Routes      routing.Table
+	Team        team.Directory
+	Rules       *rules.Set
+	Limits      hook.Limits
+	Redactor    *redact.Redactor
+	Templates   render.Set
+	Blocks      bool
+	Screenshots bool
+}
+
+// Apply replaces the runtime settings. Events already being processed
+// finish with the previous settings.
+func (h *Handler) Apply(s Settings) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Channel = s.Channel
+	h.UserID = s.UserID
+	h.Routes = s.Routes
+	h.Team = s.Team
+	h.Rules = s.Rules
+	h.Limits = s.Limits
+	h.Redactor = s.Redactor
+	h.Templates = s.Templates
+	h.Blocks = s.Blocks
+	h.Screenshots = s.Screenshots
+}
+
+// settings returns a snapshot of the runtime settings.
+func (h *Handler) settings() Settings {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s := Settings{
+		Channel:     h.Channel,
+		UserID:      h.UserID,
+		Routes:      h.Routes,
+		Team:        h.Team,
+		Rules:       h.Rules,
+		Limits:      h.Limits,
+		Redactor:    h.Redactor,
+		Templates:   h.Templates,
+		Blocks:      h.Blocks,
+		Screenshots: h.Screenshots,
+	}
+	if s.Limits == (hook.Limits{}) {
+		s.Limits = hook.DefaultLimits
+	}
+	if s.Redactor == nil {
+		s.Redactor = redact.Default
+	}
+	return s
+}
+
+// message builds the notification for input, using the first matching
+// template or the default layout. Secrets are redacted before the parts
+// are truncated, so a cut-off secret cannot slip through.
+func (s Settings) message(input hook.Input, prompt, response string, isReply bool, session render.Session) slack.Message {
+	input.ToolInput = s.Redactor.JSON(input.ToolInput)
+	prompt, response = s.Redactor.String(prompt), s.Redactor.String(response)
+	d := render.NewData(input, prompt, response, isReply, session)
+
+	var (
+		msg                slack.Message
+		hasText, hasBlocks bool
+	)
+	if t, ok := s.Templates.Match(input.HookEventName, input.ToolName); ok {
+		var err error
+		if msg.Text, hasText, err = t.Execute(d); err != nil {
+			slog.Warn("message template failed, using the default layout", logging.Event, input.HookEventName, logging.SessionID, input.SessionID, "error", err)
+			hasText = false
+		}
+		if msg.Blocks, hasBlocks, err = t.ExecuteBlocks(d); err != nil {
+			slog.Warn("blocks template failed, using the default layout", logging.Event, input.HookEventName, logging.SessionID, input.SessionID, "error", err)
+			hasBlocks = false
+		}
+	}
+	if !hasText {
+		msg.Text = s.Limits.BuildMessage(input, prompt, response, isReply)
+	}
+	// A text template replaces the default blocks too, or it would only
+	// show up in notifications.
+	if !hasBlocks && !hasText && s.Blocks {
+		msg.Blocks = render.Blocks(d, s.Limits)
+	}
+	return msg
+}
+
+// event is a hook input together with the request metadata needed to process it.
+type event struct {
+	Input      hook.Input
+	TmuxTarget string
+	// Route is the X-Cc-Slack-Route header, matched by routing rules.
+	Route string
+	// Identity is the X-Cc-Slack-User header naming the developer who
+	// runs the session, used in team mode.
+	Identity string
 }
 
 // HandleHook processes a hook event sent via POST.
@@ -32,40 +201,422 @@ func (h *Handler) HandleHook(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
+	metrics.HookEvent(input.HookEventName, input.ToolName)
+
+	ev := event{
+		Input:      input,
+		TmuxTarget: r.Header.Get("X-Tmux-Target"),
+		Route:      r.Header.Get("X-Cc-Slack-Route"),
+		Identity:   r.Header.Get("X-Cc-Slack-User"),
+	}
+
+	if h.Queue != nil {
+		if !h.Queue.Enqueue(input.SessionID, func() { h.process(ev) }) {
+			slog.Warn("hook queue full, dropping event", logging.Event, input.HookEventName, logging.SessionID, input.SessionID)
+			http.Error(w, "queue full", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err := h.process(ev); err != nil {
+		http.Error(w, "slack post failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// process builds the notification for ev and posts it to Slack.
+// When the post fails and an Outbox is configured, the notification is
+// queued for later delivery instead of being lost.
+func (h *Handler) process(ev event) error {
+	input := ev.Input
 
 	// Wait briefly for the transcript file to be fully written.
 	time.Sleep(500 * time.Millisecond)
 
-	prompt, response := hook.ScanTranscript(input.TranscriptPath)
-	threadTS := h.Threads.Get(input.SessionID)
-	isReply := threadTS != ""
-	text := hook.BuildMessage(input, prompt, response, isReply)
-	if uid := h.mentionTarget(); uid != "" {
-		text = fmt.Sprintf("<@%s> %s", uid, text)
+	start := time.Now()
+	transcript := hook.ReadTranscript(input.TranscriptPath)
+	metrics.HookDuration.WithLabelValues("transcript").Observe(time.Since(start).Seconds())
+	prompt, response := transcript.Prompt, transcript.Response
+
+	cfg := h.settings()
+
+	// Hold the session lock until the thread_ts is stored, so concurrent
+	// events for a new session cannot each post a parent message.
+	unlock := h.lockSession(input.SessionID)
+	defer unlock()
+	// sent is the message this event ended up in, if it was posted.
+	// Dropped events are tracked too: they still show that a pending
+	// prompt was answered.
+	var sent sentMessage
+	defer func() { h.trackPrompt(input, sent) }()
+
+	action := cfg.Rules.Evaluate(ruleEvent(input, transcript))
+	if action == rules.Drop {
+		slog.Debug("event dropped by rule", logging.Event, input.HookEventName, logging.SessionID, input.SessionID)
+		return nil
+	}
+	channel, mention := cfg.destination(ev)
+	if action == rules.Silent {
+		mention = ""
+	}
+
+	// Replies go to the channel the session's thread lives in.
+	thread, _ := h.Threads.Lookup(input.SessionID)
+	threadTS := thread.ThreadTS
+	if threadTS != "" {
+		channel = thread.Channel
+	}
+	// Earlier events of this session still waiting in the outbox must be
+	// delivered first; this one joins them to keep the thread in order.
+	queued := h.Outbox != nil && h.Outbox.HasSession(input.SessionID)
+	isReply := threadTS != "" || queued
+	session := render.Session{
+		ID:         input.SessionID,
+		Cwd:        input.Cwd,
+		TmuxTarget: ev.TmuxTarget,
+		Owner:      ev.Identity,
+		Time:       time.Now(),
+	}
+	if !transcript.PromptAt.IsZero() {
+		session.Duration = time.Since(transcript.PromptAt)
+	}
+	if cfg.Blocks || len(cfg.Templates) > 0 {
+		session.Branch = routing.GitBranch(input.Cwd)
+	}
+	msg := cfg.message(input, prompt, response, isReply, session)
+	entry := OutboxEntry{
+		SessionID:  input.SessionID,
+		Event:      input.HookEventName,
+		Channel:    channel,
+		Mention:    mention,
+		Text:       msg.Text,
+		Blocks:     msg.Blocks,
+		ThreadTS:   threadTS,
+		Reply:      isReply,
+		TmuxTarget: ev.TmuxTarget,
+		Owner:      ev.Identity,
+		CreatedAt:  time.Now(),
+	}
+
+	if queued {
+		return h.enqueueOutbox(entry)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postTimeout)
+	defer cancel()
+
+	start = time.Now()
+	// A permission prompt is best understood with the dialog in view.
+	screenshot := cfg.Screenshots && input.HookEventName == "PermissionRequest" && ev.TmuxTarget != ""
+	if s, ok := h.coalesce(ctx, cfg, input, prompt, response, session, entry.Mention); ok {
+		metrics.HookDuration.WithLabelValues("slack").Observe(time.Since(start).Seconds())
+		sent = s
+		if screenshot {
+			h.attachScreenshot(s.Channel, cmp.Or(threadTS, s.TS), ev.TmuxTarget, cfg.Redactor)
+		}
+		return nil
 	}
 
-	responseTS, err := h.Slack.PostMessage(h.Channel, text, threadTS)
+	channelID, responseTS, msg, err := h.postMessage(ctx, entry.Channel, withMention(entry.Mention, msg), threadTS)
+	metrics.HookDuration.WithLabelValues("slack").Observe(time.Since(start).Seconds())
 	if err != nil {
-		log.Printf("failed to send slack message: %v", err)
-		http.Error(w, "slack post failed", http.StatusInternalServerError)
-		return
+		slog.Error("failed to send slack message", logging.Event, input.HookEventName, logging.SessionID, input.SessionID, "error", err)
+		if h.Outbox == nil || !slack.IsTransient(err) {
+			return err
+		}
+		return h.enqueueOutbox(entry)
 	}
 
+	sent = sentMessage{Channel: channelID, TS: responseTS, Message: msg}
+	slog.Debug("posted notification", logging.Event, input.HookEventName, logging.SessionID, input.SessionID,
+		logging.Channel, channelID, logging.ThreadTS, cmp.Or(threadTS, responseTS), logging.TmuxTarget, ev.TmuxTarget)
+	if screenshot {
+		h.attachScreenshot(channelID, cmp.Or(threadTS, responseTS), ev.TmuxTarget, cfg.Redactor)
+	}
 	if input.SessionID != "" && threadTS == "" && responseTS != "" {
-		tmuxTarget := r.Header.Get("X-Tmux-Target")
-		h.Threads.Set(input.SessionID, responseTS, tmuxTarget)
+		h.Threads.Set(input.SessionID, Thread{
+			Channel:    channelID,
+			ThreadTS:   responseTS,
+			TmuxTarget: ev.TmuxTarget,
+			Owner:      ev.Identity,
+		})
+	}
+	if h.CoalesceWindow > 0 && input.SessionID != "" && responseTS != "" {
+		h.recent.Set(input.SessionID, recentPost{
+			Channel:   channelID,
+			TS:        responseTS,
+			Reply:     isReply,
+			UpdatedAt: time.Now(),
+			Events:    1,
+		}, h.CoalesceWindow)
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// Slack is reachable again; replay anything that failed earlier.
+	if h.Outbox != nil && h.Outbox.Len() > 0 {
+		h.goBackground(func() {
+			if err := h.FlushOutbox(context.Background()); err != nil {
+				slog.Warn("outbox flush failed", "error", err)
+			}
+		})
+	}
+	return nil
+}
+
+// goBackground runs f in a goroutine that Drain waits for.
+func (h *Handler) goBackground(f func()) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		f()
+	}()
+}
+
+// ruleEvent describes input for rule matching.
+func ruleEvent(input hook.Input, transcript hook.Transcript) rules.Event {
+	ev := rules.Event{
+		Name: input.HookEventName,
+		Tool: input.ToolName,
+		Cwd:  input.Cwd,
+	}
+	ev.Input = hook.FormatToolInput(input.ToolName, input.ToolInput)
+	if ev.Input == "" {
+		ev.Input = string(input.ToolInput)
+	}
+	if !transcript.PromptAt.IsZero() {
+		ev.Duration = time.Since(transcript.PromptAt)
+	}
+	return ev
+}
+
+// coalesce updates the session's recent message with input when it was
+// posted or last updated within CoalesceWindow. The edit shows the latest event and, unlike
+// a new post, does not trigger another push notification.
+// It returns the updated message and whether the update succeeded.
+func (h *Handler) coalesce(ctx context.Context, cfg Settings, input hook.Input, prompt, response string, session render.Session, mention string) (sentMessage, bool) {
+	if h.CoalesceWindow <= 0 || input.SessionID == "" {
+		return sentMessage{}, false
+	}
+	p, ok := h.recent.Get(input.SessionID, h.CoalesceWindow)
+	if !ok {
+		return sentMessage{}, false
+	}
+
+	p.Events++
+	msg := cfg.message(input, prompt, response, p.Reply, session)
+	note := fmt.Sprintf("_(%d events, updated %s)_", p.Events, time.Now().Format("15:04:05"))
+	msg.Text += "\n" + note
+	if len(msg.Blocks) > 0 {
+		msg.Blocks = append(msg.Blocks, render.Note(note))
+	}
+	msg = withMention(mention, msg)
+	if err := h.Slack.UpdateMessage(ctx, p.Channel, p.TS, msg); err != nil {
+		slog.Warn("failed to update slack message, posting instead", logging.SessionID, input.SessionID, "error", err)
+		return sentMessage{}, false
+	}
+	p.UpdatedAt = time.Now()
+	h.recent.Set(input.SessionID, p, h.CoalesceWindow)
+	return sentMessage{Channel: p.Channel, TS: p.TS, Message: msg}, true
+}
+
+func (h *Handler) enqueueOutbox(entry OutboxEntry) error {
+	if err := h.Outbox.Add(entry); err != nil {
+		slog.Error("failed to queue slack message", logging.Event, entry.Event, logging.SessionID, entry.SessionID, "error", err)
+		return err
+	}
+	slog.Info("queued event in outbox", logging.Event, entry.Event, logging.SessionID, entry.SessionID)
+	return nil
+}
+
+// FlushOutbox delivers queued notifications in order. It stops at the first
+// transient failure so that later entries never overtake earlier ones.
+// Entries older than StaleAfter are delivered marked as stale and without
+// a mention. It returns at once when another flush is running.
+func (h *Handler) FlushOutbox(ctx context.Context) error {
+	if h.Outbox == nil || !h.Outbox.flushing.TryLock() {
+		return nil
+	}
+	defer h.Outbox.flushing.Unlock()
+	return h.flushOutbox(ctx)
+}
+
+// flushOutbox delivers the outbox. The caller holds Outbox.flushing.
+func (h *Handler) flushOutbox(ctx context.Context) error {
+	for _, e := range h.Outbox.Entries() {
+		if err := h.deliver(ctx, e); err != nil {
+			// Keep the entry when the flush itself was cancelled.
+			if slack.IsTransient(err) || ctx.Err() != nil {
+				return err
+			}
+			slog.Error("dropping outbox entry", "id", e.ID, logging.Event, e.Event, logging.SessionID, e.SessionID, "error", err)
+		}
+		if err := h.Outbox.Remove(e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) deliver(ctx context.Context, e OutboxEntry) error {
+	unlock := h.lockSession(e.SessionID)
+	defer unlock()
+
+	channel, threadTS := e.Channel, e.ThreadTS
+	if threadTS == "" && e.Reply {
+		// The parent was queued too; it has been delivered by now.
+		if t, ok := h.Threads.Lookup(e.SessionID); ok {
+			channel, threadTS = t.Channel, t.ThreadTS
+		}
+	}
+
+	msg := withMention(e.Mention, slack.Message{Text: e.Text, Blocks: e.Blocks})
+	if age := time.Since(e.CreatedAt); age > h.staleAfter() {
+		note := fmt.Sprintf("_(stale: queued at %s while Slack was unreachable)_", e.CreatedAt.Format("2006-01-02 15:04:05"))
+		msg = slack.Message{Text: note + "\n" + e.Text}
+		if len(e.Blocks) > 0 {
+			msg.Blocks = append(slack.Blocks{render.Note(note)}, e.Blocks...)
+		}
+	}
+
+	postCtx, cancel := context.WithTimeout(ctx, postTimeout)
+	defer cancel()
+	channelID, responseTS, _, err := h.postMessage(postCtx, channel, msg, threadTS)
+	if err != nil {
+		return err
+	}
+
+	if e.SessionID != "" && threadTS == "" && responseTS != "" {
+		h.Threads.Set(e.SessionID, Thread{
+			Channel:    channelID,
+			ThreadTS:   responseTS,
+			TmuxTarget: e.TmuxTarget,
+			Owner:      e.Owner,
+		})
+	}
+	return nil
+}
+
+// postMessage posts msg, and posts its text alone when Slack rejects the
+// message for good, such as for invalid blocks, so that a rendering problem
+// does not lose the notification. It returns the message that was posted.
+func (h *Handler) postMessage(ctx context.Context, channel string, msg slack.Message, threadTS string) (string, string, slack.Message, error) {
+	channelID, ts, err := h.Slack.PostMessage(ctx, channel, msg, threadTS)
+	if err == nil || len(msg.Blocks) == 0 || slack.IsTransient(err) {
+		return channelID, ts, msg, err
+	}
+	slog.Warn("failed to post slack message with blocks, posting text only", logging.Channel, channel, "error", err)
+	msg.Blocks = nil
+	channelID, ts, err = h.Slack.PostMessage(ctx, channel, msg, threadTS)
+	return channelID, ts, msg, err
+}
+
+// Drain stops accepting hooks, waits for queued events and the work they
+// left running in the background, and tries once more to deliver the
+// outbox, after any flush already running. Whatever is not delivered when
+// ctx is done stays in the outbox for the next start.
+func (h *Handler) Drain(ctx context.Context) error {
+	if h.Queue != nil {
+		if err := wait(ctx, h.Queue.Close); err != nil {
+			return fmt.Errorf("drain hook queue: %w", err)
+		}
+	}
+	if err := wait(ctx, h.background.Wait); err != nil {
+		return fmt.Errorf("drain background work: %w", err)
+	}
+	if h.Outbox == nil {
+		return nil
+	}
+	if err := h.Outbox.lockFlush(ctx); err != nil {
+		return fmt.Errorf("flush outbox: %w", err)
+	}
+	defer h.Outbox.flushing.Unlock()
+	if err := h.flushOutbox(ctx); err != nil {
+		return fmt.Errorf("flush outbox: %w", err)
+	}
+	return nil
+}
+
+// wait calls f and returns when it does or when ctx is done, whichever
+// comes first.
+func wait(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Handler) staleAfter() time.Duration {
+	if h.StaleAfter > 0 {
+		return h.StaleAfter
+	}
+	return defaultStaleAfter
+}
+
+// lockSession locks sessionID and returns its unlock func.
+// Events without a session ID are not serialized.
+func (h *Handler) lockSession(sessionID string) (unlock func()) {
+	if sessionID == "" {
+		return func() {}
+	}
+	return h.sessions.Lock(sessionID)
+}
+
+// withMention prefixes msg with a mention of uid, if set.
+func withMention(uid string, msg slack.Message) slack.Message {
+	if uid == "" {
+		return msg
+	}
+	mention := fmt.Sprintf("<@%s>", uid)
+	msg.Text = mention + " " + msg.Text
+	if len(msg.Blocks) > 0 {
+		msg.Blocks = append(slack.Blocks{render.Note(mention)}, msg.Blocks...)
+	}
+	return msg
+}
+
+// destination returns the channel for a new thread of ev and the user to
+// mention. The first matching route wins, then the owner's DM in team
+// mode, then the default channel. A known owner is always the one mentioned.
+func (s Settings) destination(ev event) (channel, mention string) {
+	member, isMember := s.Team.Lookup(ev.Identity)
+	if len(s.Team) > 0 && ev.Identity != "" && !isMember {
+		slog.Warn("unknown identity", "identity", ev.Identity, logging.SessionID, ev.Input.SessionID)
+	}
+
+	channel, userID := s.Channel, s.UserID
+	route, routed := s.Routes.Match(routing.Request{
+		Cwd:       ev.Input.Cwd,
+		Header:    ev.Route,
+		GitRemote: func() string { return routing.GitRemote(ev.Input.Cwd) },
+	})
+	switch {
+	case routed:
+		channel, userID = route.Channel, route.MentionUser
+	case isMember && member.DM:
+		channel = member.SlackID
+	}
+	if isMember {
+		userID = member.SlackID
+	}
+	return channel, mentionTarget(channel, userID)
 }
 
 // mentionTarget returns the user ID to mention, or empty string if none.
-func (h *Handler) mentionTarget() string {
-	if h.UserID != "" {
-		return h.UserID
+func mentionTarget(channel, userID string) string {
+	if userID != "" {
+		return userID
 	}
-	if strings.HasPrefix(h.Channel, "U") {
-		return h.Channel
+	if strings.HasPrefix(channel, "U") {
+		return channel
 	}
 	return ""
 }
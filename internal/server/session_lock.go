@@ -0,0 +1,41 @@
+package server
+
+import "sync"
+
+// sessionLocks serializes work per session ID. The zero value is ready to use.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock blocks until the lock for sessionID is held and returns its unlock func.
+// Locks are released from the map once no goroutine holds or waits on them.
+func (s *sessionLocks) Lock(sessionID string) (unlock func()) {
+	s.mu.Lock()
+	if s.locks == nil {
+		s.locks = make(map[string]*sessionLock)
+	}
+	l, ok := s.locks[sessionID]
+	if !ok {
+		l = &sessionLock{}
+		s.locks[sessionID] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, sessionID)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSessionLocks(t *testing.T) {
+	t.Run("serializes holders of the same session", func(t *testing.T) {
+		var locks sessionLocks
+		var wg sync.WaitGroup
+		active := 0
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock := locks.Lock("sess-1")
+				defer unlock()
+				active++
+				if active != 1 {
+					t.Errorf("active = %d, want 1", active)
+				}
+				active--
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("releases entries when unlocked", func(t *testing.T) {
+		var locks sessionLocks
+		unlockA := locks.Lock("a")
+		unlockB := locks.Lock("b")
+		unlockA()
+		unlockB()
+		if n := len(locks.locks); n != 0 {
+			t.Errorf("locks = %d, want 0", n)
+		}
+	})
+}
@@ -1,27 +1,84 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"sync"
 	"time"
+
+	"github.com/nktks/cc-slack/internal/answer"
+	"github.com/nktks/cc-slack/internal/slack"
 )
 
-// ThreadStore holds session_id to thread_ts mappings in memory.
+// ThreadStore holds session_id to thread mappings in memory.
 type ThreadStore struct {
 	mu      sync.RWMutex
-	threads map[string]threadEntry
+	threads map[string]Thread
+}
+
+// Thread is the Slack thread a session's notifications are posted to.
+type Thread struct {
+	// Channel is the conversation ID the parent message was posted to.
+	Channel    string `json:"channel"`
+	ThreadTS   string `json:"thread_ts"`
+	TmuxTarget string `json:"tmux_target,omitempty"`
+	// Owner is the team mode identity of the developer running the session.
+	Owner string `json:"owner,omitempty"`
+	// Pending is the permission prompt the session is waiting on, if any.
+	Pending   *Prompt   `json:"pending,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
-type threadEntry struct {
-	ThreadTS   string
-	TmuxTarget string
-	CreatedAt  time.Time
+// Prompt is a permission request posted to a thread and not yet answered.
+type Prompt struct {
+	Tool     string    `json:"tool"`
+	PostedAt time.Time `json:"posted_at"`
+	// Options are the labels of the answers, in the order of their numbers.
+	Options []string `json:"options,omitempty"`
+	// Questions are the questions of an AskUserQuestion prompt.
+	Questions []answer.Question `json:"questions,omitempty"`
+	// Channel and TS locate the message, which is edited once the prompt
+	// is answered. They are empty if the message was queued in the outbox.
+	Channel string        `json:"channel,omitempty"`
+	TS      string        `json:"ts,omitempty"`
+	Message slack.Message `json:"message"`
 }
 
 // NewThreadStore creates a new empty ThreadStore.
 func NewThreadStore() *ThreadStore {
 	return &ThreadStore{
-		threads: make(map[string]threadEntry),
+		threads: make(map[string]Thread),
+	}
+}
+
+// LoadThreadStore reads a store written by Save, or returns an empty store
+// if path does not exist.
+func LoadThreadStore(path string) (*ThreadStore, error) {
+	s := NewThreadStore()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read thread store: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.threads); err != nil {
+		return nil, fmt.Errorf("parse thread store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the store to path, replacing it atomically.
+func (s *ThreadStore) Save(path string) error {
+	s.mu.RLock()
+	data, err := json.MarshalIndent(s.threads, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("encode thread store: %w", err)
 	}
+	return writeFileAtomic(path, data)
 }
 
 // Get returns the thread_ts for a session, or empty string if not found.
@@ -31,30 +88,94 @@ func (s *ThreadStore) Get(sessionID string) string {
 	return s.threads[sessionID].ThreadTS
 }
 
-// Set stores the thread_ts and tmux target for a session.
-func (s *ThreadStore) Set(sessionID, threadTS, tmuxTarget string) {
+// Lookup returns the thread for a session.
+func (s *ThreadStore) Lookup(sessionID string) (Thread, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.threads[sessionID]
+	return t, ok
+}
+
+// Set stores the thread for a session. CreatedAt is set to the current time.
+func (s *ThreadStore) Set(sessionID string, t Thread) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.threads[sessionID] = threadEntry{
-		ThreadTS:   threadTS,
-		TmuxTarget: tmuxTarget,
-		CreatedAt:  time.Now(),
+	t.CreatedAt = time.Now()
+	s.threads[sessionID] = t
+}
+
+// SetPending records the prompt a session is waiting on, or clears it when
+// p is nil. Sessions without a thread are ignored.
+func (s *ThreadStore) SetPending(sessionID string, p *Prompt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.threads[sessionID]
+	if !ok {
+		return
 	}
+	t.Pending = p
+	s.threads[sessionID] = t
 }
 
-// GetByThreadTS returns the tmux target for a given thread_ts.
-// Returns empty string and false if not found.
-func (s *ThreadStore) GetByThreadTS(threadTS string) (tmuxTarget string, ok bool) {
+// TakePending returns the prompt a session is waiting on and clears it, so
+// that only one caller handles its answer.
+func (s *ThreadStore) TakePending(sessionID string) *Prompt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.threads[sessionID]
+	if !ok || t.Pending == nil {
+		return nil
+	}
+	p := t.Pending
+	t.Pending = nil
+	s.threads[sessionID] = t
+	return p
+}
+
+// SessionByThreadTS returns the session whose thread is threadTS in channel.
+func (s *ThreadStore) SessionByThreadTS(channel, threadTS string) (string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	for _, entry := range s.threads {
-		if entry.ThreadTS == threadTS {
-			return entry.TmuxTarget, true
+	for id, entry := range s.threads {
+		if entry.Channel == channel && entry.ThreadTS == threadTS {
+			return id, true
 		}
 	}
 	return "", false
 }
 
+// GetByThreadTS returns the thread with threadTS in channel.
+func (s *ThreadStore) GetByThreadTS(channel, threadTS string) (Thread, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, entry := range s.threads {
+		if entry.Channel == channel && entry.ThreadTS == threadTS {
+			return entry, true
+		}
+	}
+	return Thread{}, false
+}
+
+// GetByPromptTS returns the thread whose pending prompt was posted as the
+// message ts in channel.
+func (s *ThreadStore) GetByPromptTS(channel, ts string) (Thread, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, entry := range s.threads {
+		if p := entry.Pending; p != nil && p.Channel == channel && p.TS == ts {
+			return entry, true
+		}
+	}
+	return Thread{}, false
+}
+
+// Len returns the number of sessions with a thread.
+func (s *ThreadStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.threads)
+}
+
 // CleanOlderThan removes entries older than maxAge.
 func (s *ThreadStore) CleanOlderThan(maxAge time.Duration) {
 	s.mu.Lock()
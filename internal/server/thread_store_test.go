@@ -1,9 +1,13 @@
 package server
 
 import (
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/nktks/cc-slack/internal/render"
+	"github.com/nktks/cc-slack/internal/slack"
 )
 
 func TestThreadStore(t *testing.T) {
@@ -16,7 +20,7 @@ func TestThreadStore(t *testing.T) {
 
 	t.Run("set and get", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("sess-1", "123.456", "")
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456"})
 		if ts := s.Get("sess-1"); ts != "123.456" {
 			t.Errorf("ts = %q, want %q", ts, "123.456")
 		}
@@ -24,8 +28,8 @@ func TestThreadStore(t *testing.T) {
 
 	t.Run("set overwrites existing entry", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("sess-1", "111.111", "")
-		s.Set("sess-1", "222.222", "")
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "111.111"})
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "222.222"})
 		if ts := s.Get("sess-1"); ts != "222.222" {
 			t.Errorf("ts = %q, want %q", ts, "222.222")
 		}
@@ -33,20 +37,23 @@ func TestThreadStore(t *testing.T) {
 
 	t.Run("multiple sessions are independent", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("sess-1", "111.111", "")
-		s.Set("sess-2", "222.222", "")
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "111.111"})
+		s.Set("sess-2", Thread{Channel: "C1", ThreadTS: "222.222"})
 		if ts := s.Get("sess-1"); ts != "111.111" {
 			t.Errorf("sess-1 ts = %q, want %q", ts, "111.111")
 		}
 		if ts := s.Get("sess-2"); ts != "222.222" {
 			t.Errorf("sess-2 ts = %q, want %q", ts, "222.222")
 		}
+		if n := s.Len(); n != 2 {
+			t.Errorf("len = %d, want 2", n)
+		}
 	})
 
 	t.Run("clean removes old entries", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("old", "111.111", "")
-		s.Set("new", "222.222", "")
+		s.Set("old", Thread{Channel: "C1", ThreadTS: "111.111"})
+		s.Set("new", Thread{Channel: "C1", ThreadTS: "222.222"})
 
 		// manually set old entry's timestamp
 		s.mu.Lock()
@@ -67,8 +74,8 @@ func TestThreadStore(t *testing.T) {
 
 	t.Run("clean does nothing when all entries are recent", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("a", "111.111", "")
-		s.Set("b", "222.222", "")
+		s.Set("a", Thread{Channel: "C1", ThreadTS: "111.111"})
+		s.Set("b", Thread{Channel: "C1", ThreadTS: "222.222"})
 
 		s.CleanOlderThan(24 * time.Hour)
 
@@ -82,23 +89,23 @@ func TestThreadStore(t *testing.T) {
 
 	t.Run("get by thread_ts returns tmux target", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("sess-1", "123.456", "mysession:0.0")
-		s.Set("sess-2", "789.012", "other:1.0")
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456", TmuxTarget: "mysession:0.0"})
+		s.Set("sess-2", Thread{Channel: "C1", ThreadTS: "789.012", TmuxTarget: "other:1.0"})
 
-		target, ok := s.GetByThreadTS("123.456")
+		th, ok := s.GetByThreadTS("C1", "123.456")
 		if !ok {
 			t.Fatal("expected ok=true")
 		}
-		if target != "mysession:0.0" {
-			t.Errorf("target = %q, want %q", target, "mysession:0.0")
+		if th.TmuxTarget != "mysession:0.0" {
+			t.Errorf("target = %q, want %q", th.TmuxTarget, "mysession:0.0")
 		}
 	})
 
 	t.Run("get by thread_ts returns false for unknown", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("sess-1", "123.456", "mysession:0.0")
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456", TmuxTarget: "mysession:0.0"})
 
-		_, ok := s.GetByThreadTS("999.999")
+		_, ok := s.GetByThreadTS("C1", "999.999")
 		if ok {
 			t.Error("expected ok=false for unknown thread_ts")
 		}
@@ -106,14 +113,138 @@ func TestThreadStore(t *testing.T) {
 
 	t.Run("get by thread_ts returns empty target when no tmux", func(t *testing.T) {
 		s := NewThreadStore()
-		s.Set("sess-1", "123.456", "")
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456"})
 
-		target, ok := s.GetByThreadTS("123.456")
+		th, ok := s.GetByThreadTS("C1", "123.456")
 		if !ok {
 			t.Fatal("expected ok=true")
 		}
-		if target != "" {
-			t.Errorf("target = %q, want empty", target)
+		if th.TmuxTarget != "" {
+			t.Errorf("target = %q, want empty", th.TmuxTarget)
+		}
+	})
+
+	t.Run("get by thread_ts is scoped to the channel", func(t *testing.T) {
+		s := NewThreadStore()
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456", TmuxTarget: "mysession:0.0"})
+
+		if _, ok := s.GetByThreadTS("C2", "123.456"); ok {
+			t.Error("expected ok=false for another channel")
+		}
+	})
+
+	t.Run("lookup returns the stored thread", func(t *testing.T) {
+		s := NewThreadStore()
+		s.Set("sess-1", Thread{Channel: "D1", ThreadTS: "123.456", TmuxTarget: "main:0.0"})
+
+		th, ok := s.Lookup("sess-1")
+		if !ok {
+			t.Fatal("expected ok=true")
+		}
+		if th.Channel != "D1" || th.ThreadTS != "123.456" || th.TmuxTarget != "main:0.0" {
+			t.Errorf("thread = %+v", th)
+		}
+		if th.CreatedAt.IsZero() {
+			t.Error("created at should be set")
+		}
+		if _, ok := s.Lookup("unknown"); ok {
+			t.Error("expected ok=false for unknown session")
+		}
+	})
+
+	t.Run("set pending updates an existing thread", func(t *testing.T) {
+		s := NewThreadStore()
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456"})
+
+		s.SetPending("sess-1", &Prompt{Tool: "Bash"})
+		th, _ := s.Lookup("sess-1")
+		if th.Pending == nil || th.Pending.Tool != "Bash" {
+			t.Errorf("pending = %+v, want Bash", th.Pending)
+		}
+
+		s.SetPending("sess-1", nil)
+		if th, _ := s.Lookup("sess-1"); th.Pending != nil {
+			t.Errorf("pending = %+v, want nil", th.Pending)
+		}
+
+		s.SetPending("unknown", &Prompt{Tool: "Bash"})
+		if _, ok := s.Lookup("unknown"); ok {
+			t.Error("set pending should not create a thread")
+		}
+	})
+
+	t.Run("take pending clears the prompt", func(t *testing.T) {
+		s := NewThreadStore()
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456"})
+		s.SetPending("sess-1", &Prompt{Tool: "Bash"})
+
+		if p := s.TakePending("sess-1"); p == nil || p.Tool != "Bash" {
+			t.Errorf("take = %+v, want Bash", p)
+		}
+		if p := s.TakePending("sess-1"); p != nil {
+			t.Errorf("second take = %+v, want nil", p)
+		}
+		if id, ok := s.SessionByThreadTS("C1", "123.456"); !ok || id != "sess-1" {
+			t.Errorf("session = %q (ok=%v), want sess-1", id, ok)
+		}
+	})
+
+	t.Run("get by prompt ts", func(t *testing.T) {
+		s := NewThreadStore()
+		s.Set("sess-1", Thread{Channel: "C1", ThreadTS: "123.456"})
+		s.Set("sess-2", Thread{Channel: "C1", ThreadTS: "234.567"})
+		s.SetPending("sess-2", &Prompt{Tool: "Bash", Channel: "C1", TS: "234.999"})
+
+		if th, ok := s.GetByPromptTS("C1", "234.999"); !ok || th.ThreadTS != "234.567" {
+			t.Errorf("thread = %+v (ok=%v), want 234.567", th, ok)
+		}
+		if _, ok := s.GetByPromptTS("C2", "234.999"); ok {
+			t.Error("prompt in another channel should not match")
+		}
+		s.TakePending("sess-2")
+		if _, ok := s.GetByPromptTS("C1", "234.999"); ok {
+			t.Error("answered prompt should not match")
+		}
+	})
+
+	t.Run("save and load round trip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state", "threads.json")
+		s := NewThreadStore()
+		s.Set("sess-1", Thread{Channel: "D1", ThreadTS: "123.456", TmuxTarget: "main:0.0", Owner: "alice"})
+		s.SetPending("sess-1", &Prompt{Tool: "Bash", PostedAt: time.Now(), TS: "123.999", Message: slack.Message{
+			Text:   "[PermissionRequest] Bash",
+			Blocks: slack.Blocks{render.Note("pending")},
+		}})
+		if err := s.Save(path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		loaded, err := LoadThreadStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		th, ok := loaded.GetByThreadTS("D1", "123.456")
+		if !ok || th.TmuxTarget != "main:0.0" || th.Owner != "alice" {
+			t.Errorf("thread = %+v (ok=%v)", th, ok)
+		}
+		if th.Pending == nil || th.Pending.Tool != "Bash" {
+			t.Fatalf("pending = %+v, want Bash", th.Pending)
+		}
+		if m := th.Pending.Message; m.Text != "[PermissionRequest] Bash" || len(m.Blocks) != 1 {
+			t.Errorf("pending message = %+v, want text and one block", m)
+		}
+		if th.CreatedAt.IsZero() {
+			t.Error("created at should be kept")
+		}
+	})
+
+	t.Run("load returns empty store for missing file", func(t *testing.T) {
+		s, err := LoadThreadStore(filepath.Join(t.TempDir(), "missing.json"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s.Len() != 0 {
+			t.Errorf("len = %d, want 0", s.Len())
 		}
 	})
 
@@ -125,7 +256,7 @@ func TestThreadStore(t *testing.T) {
 			go func(i int) {
 				defer wg.Done()
 				id := "sess-" + string(rune('A'+i%26))
-				s.Set(id, "ts-"+id, "")
+				s.Set(id, Thread{Channel: "C1", ThreadTS: "ts-" + id})
 				s.Get(id)
 			}(i)
 		}
@@ -1,37 +1,292 @@
 package slack
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
 
+	"github.com/nktks/cc-slack/internal/metrics"
 	slackapi "github.com/slack-go/slack"
 )
 
+const (
+	// maxAttempts is the number of times a call is tried before giving up.
+	maxAttempts = 5
+	// baseBackoff is the delay before the first retry; it doubles per attempt.
+	baseBackoff = 500 * time.Millisecond
+	// maxBackoff caps the delay between retries.
+	maxBackoff = 30 * time.Second
+	// channelInterval paces posts to a single channel, following Slack's
+	// guidance of roughly one message per second per channel.
+	channelInterval = time.Second
+)
+
+// transientErrors are Slack API error codes worth retrying.
+var transientErrors = map[string]bool{
+	"ratelimited":         true,
+	"internal_error":      true,
+	"fatal_error":         true,
+	"request_timeout":     true,
+	"service_unavailable": true,
+}
+
 // Client is the interface for posting Slack messages.
 type Client interface {
-	PostMessage(channel, text, threadTS string) (ts string, err error)
+	// PostMessage posts msg to channel, in the thread threadTS if set.
+	// It returns the conversation ID the message was posted to, which
+	// differs from channel when posting to a user ID, and the message ts.
+	PostMessage(ctx context.Context, channel string, msg Message, threadTS string) (channelID, ts string, err error)
+	// UpdateMessage replaces the message ts with msg.
+	UpdateMessage(ctx context.Context, channel, ts string, msg Message) error
+	// UploadFile uploads data as filename to channel, in the thread
+	// threadTS if set. channel must be a conversation ID.
+	UploadFile(ctx context.Context, channel, threadTS, filename, title string, data []byte) error
+	// AuthTest checks the token and returns the identity it belongs to.
+	AuthTest(ctx context.Context) (Identity, error)
+}
+
+// Identity is the workspace and bot user a token belongs to.
+type Identity struct {
+	Team   string
+	User   string
+	UserID string
+}
+
+// Message is a Slack message. Without Blocks, Text is the message body;
+// with Blocks, it is the fallback shown in notifications and by clients
+// that cannot display blocks.
+type Message struct {
+	Text   string `json:"text"`
+	Blocks Blocks `json:"blocks,omitempty"`
+}
+
+// Text returns a plain text message.
+func Text(text string) Message {
+	return Message{Text: text}
+}
+
+func (m Message) options() []slackapi.MsgOption {
+	return []slackapi.MsgOption{
+		slackapi.MsgOptionText(m.Text, false),
+		slackapi.MsgOptionBlocks(m.Blocks...),
+	}
+}
+
+// Blocks are Block Kit layout blocks. Unlike []slack.Block, they can be
+// decoded from JSON, so messages can be stored and read back.
+type Blocks []slackapi.Block
+
+func (b Blocks) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]slackapi.Block(b))
+}
+
+func (b *Blocks) UnmarshalJSON(data []byte) error {
+	var set slackapi.Blocks
+	if err := set.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*b = set.BlockSet
+	return nil
 }
 
 type client struct {
 	api *slackapi.Client
+
+	// interval is the minimum gap between posts to the same channel.
+	interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
 }
 
 // New creates a Slack client with the given bot token.
 func New(token string) Client {
 	return &client{
-		api: slackapi.New(token),
+		api:      slackapi.New(token),
+		interval: channelInterval,
 	}
 }
 
-func (c *client) PostMessage(channel, text, threadTS string) (string, error) {
-	var opts []slackapi.MsgOption
-	opts = append(opts, slackapi.MsgOptionText(text, false))
+func (c *client) AuthTest(ctx context.Context) (Identity, error) {
+	resp, err := c.api.AuthTestContext(ctx)
+	if err != nil {
+		metrics.SlackErrors.WithLabelValues("auth.test", ErrorCode(err)).Inc()
+		return Identity{}, fmt.Errorf("slack API error: %w", err)
+	}
+	return Identity{Team: resp.Team, User: resp.User, UserID: resp.UserID}, nil
+}
+
+func (c *client) PostMessage(ctx context.Context, channel string, msg Message, threadTS string) (string, string, error) {
+	opts := msg.options()
 	if threadTS != "" {
 		opts = append(opts, slackapi.MsgOptionTS(threadTS))
 	}
 
-	_, ts, err := c.api.PostMessage(channel, opts...)
+	var channelID, ts string
+	err := c.do(ctx, "chat.postMessage", channel, func() error {
+		var err error
+		channelID, ts, err = c.api.PostMessageContext(ctx, channel, opts...)
+		return err
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("slack API error: %w", err)
+	}
+	return channelID, ts, nil
+}
+
+func (c *client) UpdateMessage(ctx context.Context, channel, ts string, msg Message) error {
+	err := c.do(ctx, "chat.update", channel, func() error {
+		opts := msg.options()
+		if len(msg.Blocks) == 0 {
+			// Send an empty list, or the old message's blocks are kept.
+			opts = append(opts, slackapi.MsgOptionBlocks([]slackapi.Block{}...))
+		}
+		_, _, _, err := c.api.UpdateMessageContext(ctx, channel, ts, opts...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("slack API error: %w", err)
+	}
+	return nil
+}
+
+func (c *client) UploadFile(ctx context.Context, channel, threadTS, filename, title string, data []byte) error {
+	err := c.do(ctx, "files.upload", channel, func() error {
+		_, err := c.api.UploadFileV2Context(ctx, slackapi.UploadFileV2Parameters{
+			Reader:          bytes.NewReader(data),
+			FileSize:        len(data),
+			Filename:        filename,
+			Title:           title,
+			Channel:         channel,
+			ThreadTimestamp: threadTS,
+		})
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("slack API error: %w", err)
+		return fmt.Errorf("slack API error: %w", err)
+	}
+	return nil
+}
+
+// do paces call for channel and retries it on transient errors with
+// exponential backoff, honoring Retry-After on rate limits. Failed attempts
+// are counted under method.
+func (c *client) do(ctx context.Context, method, channel string, call func() error) error {
+	var err error
+	for attempt := range maxAttempts {
+		if err := sleep(ctx, c.reserve(channel)); err != nil {
+			return err
+		}
+
+		err = call()
+		if err != nil {
+			metrics.SlackErrors.WithLabelValues(method, ErrorCode(err)).Inc()
+		}
+		if err == nil || !IsTransient(err) || attempt == maxAttempts-1 {
+			return err
+		}
+
+		delay := backoff(attempt)
+		var rle *slackapi.RateLimitedError
+		if errors.As(err, &rle) && rle.RetryAfter > 0 {
+			delay = rle.RetryAfter
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// reserve claims the next send slot for channel and returns how long to
+// wait for it.
+func (c *client) reserve(channel string) time.Duration {
+	if c.interval <= 0 {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == nil {
+		c.next = make(map[string]time.Time)
+	}
+	now := time.Now()
+	slot := c.next[channel]
+	if slot.Before(now) {
+		slot = now
+	}
+	c.next[channel] = slot.Add(c.interval)
+	return slot.Sub(now)
+}
+
+// IsTransient reports whether err is worth retrying, such as a rate limit,
+// a Slack server error, a network failure or a timeout. Only a cancelled
+// context and definitive Slack API errors such as channel_not_found are not.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+	var apiErr slackapi.SlackErrorResponse
+	if errors.As(err, &apiErr) {
+		return transientErrors[apiErr.Err]
+	}
+	// Anything else is a transport failure such as a refused connection.
+	return true
+}
+
+// ErrorCode returns a short label for err: the Slack error code such as
+// "channel_not_found", "ratelimited", "http_<status>", "timeout" or
+// "transport".
+func ErrorCode(err error) string {
+	var rle *slackapi.RateLimitedError
+	if errors.As(err, &rle) {
+		return "ratelimited"
+	}
+	var apiErr slackapi.SlackErrorResponse
+	if errors.As(err, &apiErr) {
+		return apiErr.Err
+	}
+	var statusErr slackapi.StatusCodeError
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("http_%d", statusErr.Code)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	return "transport"
+}
+
+// backoff returns the jittered delay before retry number attempt+1.
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << attempt
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + rand.N(d/2)
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
 	}
-	return ts, nil
 }
@@ -1,12 +1,16 @@
 package slack
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	slackapi "github.com/slack-go/slack"
 )
@@ -40,15 +44,19 @@ func TestPostMessage(t *testing.T) {
 
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]any{
-				"ok": true,
-				"ts": "1234567890.123456",
+				"ok":      true,
+				"channel": "C123",
+				"ts":      "1234567890.123456",
 			})
 		})
 
-		ts, err := c.PostMessage("C123", "hello", "")
+		channel, ts, err := c.PostMessage(context.Background(), "C123", Text("hello"), "")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
+		if channel != "C123" {
+			t.Errorf("channel = %q, want %q", channel, "C123")
+		}
 		if ts != "1234567890.123456" {
 			t.Errorf("ts = %q, want %q", ts, "1234567890.123456")
 		}
@@ -69,12 +77,36 @@ func TestPostMessage(t *testing.T) {
 			})
 		})
 
-		_, err := c.PostMessage("C123", "reply", "1111111111.111111")
+		_, _, err := c.PostMessage(context.Background(), "C123", Text("reply"), "1111111111.111111")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
 	})
 
+	t.Run("sends blocks with text fallback", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			params, _ := url.ParseQuery(string(body))
+			if params.Get("text") != "fallback" {
+				t.Errorf("text = %q, want %q", params.Get("text"), "fallback")
+			}
+			if want := `[{"type":"header","text":{"type":"plain_text","text":"Title","emoji":false}}]`; params.Get("blocks") != want {
+				t.Errorf("blocks = %s, want %s", params.Get("blocks"), want)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "ts": "1.1"})
+		})
+
+		msg := Message{
+			Text:   "fallback",
+			Blocks: Blocks{slackapi.NewHeaderBlock(slackapi.NewTextBlockObject(slackapi.PlainTextType, "Title", false, false))},
+		}
+		if _, _, err := c.PostMessage(context.Background(), "C123", msg, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
 	t.Run("returns error on slack API error", func(t *testing.T) {
 		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
@@ -84,9 +116,232 @@ func TestPostMessage(t *testing.T) {
 			})
 		})
 
-		_, err := c.PostMessage("C123", "hello", "")
+		_, _, err := c.PostMessage(context.Background(), "C123", Text("hello"), "")
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
 	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		var calls atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"ok":    false,
+				"error": "channel_not_found",
+			})
+		})
+
+		if _, _, err := c.PostMessage(context.Background(), "C123", Text("hello"), ""); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("calls = %d, want 1", n)
+		}
+	})
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		var calls atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if calls.Add(1) < 3 {
+				json.NewEncoder(w).Encode(map[string]any{
+					"ok":    false,
+					"error": "internal_error",
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"ok": true,
+				"ts": "3333333333.333333",
+			})
+		})
+
+		_, ts, err := c.PostMessage(context.Background(), "C123", Text("hello"), "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ts != "3333333333.333333" {
+			t.Errorf("ts = %q, want %q", ts, "3333333333.333333")
+		}
+		if n := calls.Load(); n != 3 {
+			t.Errorf("calls = %d, want 3", n)
+		}
+	})
+
+	t.Run("waits for Retry-After when rate limited", func(t *testing.T) {
+		var calls atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"ok": true,
+				"ts": "4444444444.444444",
+			})
+		})
+
+		start := time.Now()
+		if _, _, err := c.PostMessage(context.Background(), "C123", Text("hello"), ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("elapsed = %s, want at least 1s", elapsed)
+		}
+	})
+
+	t.Run("stops retrying when context is done", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if _, _, err := c.PostMessage(ctx, "C123", Text("hello"), ""); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("paces posts to the same channel", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"ok": true,
+				"ts": "5555555555.555555",
+			})
+		})
+		c.(*client).interval = 100 * time.Millisecond
+
+		start := time.Now()
+		for range 3 {
+			if _, _, err := c.PostMessage(context.Background(), "C123", Text("hello"), ""); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("elapsed = %s, want at least 200ms", elapsed)
+		}
+	})
+}
+
+func TestBlocksJSON(t *testing.T) {
+	in := Blocks{
+		slackapi.NewSectionBlock(slackapi.NewTextBlockObject(slackapi.MarkdownType, "*hi*", false, false), nil, nil),
+		slackapi.NewDividerBlock(),
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out Blocks
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("decoded %d blocks, want 2", len(out))
+	}
+	section, ok := out[0].(*slackapi.SectionBlock)
+	if !ok || section.Text.Text != "*hi*" {
+		t.Errorf("block 0 = %#v, want the section", out[0])
+	}
+	if out[1].BlockType() != slackapi.MBTDivider {
+		t.Errorf("block 1 type = %s, want divider", out[1].BlockType())
+	}
+}
+
+func TestUpdateMessage(t *testing.T) {
+	t.Run("sends channel, ts and text", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/chat.update" {
+				t.Errorf("path = %s, want /chat.update", r.URL.Path)
+			}
+			body, _ := io.ReadAll(r.Body)
+			params, _ := url.ParseQuery(string(body))
+			if params.Get("channel") != "C123" {
+				t.Errorf("channel = %q, want %q", params.Get("channel"), "C123")
+			}
+			if params.Get("ts") != "1111111111.111111" {
+				t.Errorf("ts = %q, want %q", params.Get("ts"), "1111111111.111111")
+			}
+			if params.Get("text") != "updated" {
+				t.Errorf("text = %q, want %q", params.Get("text"), "updated")
+			}
+			// An empty list removes the blocks of the old message.
+			if params.Get("blocks") != "[]" {
+				t.Errorf("blocks = %q, want []", params.Get("blocks"))
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"ok":      true,
+				"channel": "C123",
+				"ts":      "1111111111.111111",
+			})
+		})
+
+		if err := c.UpdateMessage(context.Background(), "C123", "1111111111.111111", Text("updated")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("returns error on slack API error", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"ok":    false,
+				"error": "message_not_found",
+			})
+		})
+
+		if err := c.UpdateMessage(context.Background(), "C123", "1.1", Text("updated")); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limit", &slackapi.RateLimitedError{RetryAfter: time.Second}, true},
+		{"server error", slackapi.StatusCodeError{Code: 503, Status: "503 Service Unavailable"}, true},
+		{"timeout", fmt.Errorf("slack API error: %w", context.DeadlineExceeded), true},
+		{"transport", io.ErrUnexpectedEOF, true},
+		{"cancelled", fmt.Errorf("slack API error: %w", context.Canceled), false},
+		{"api error", slackapi.SlackErrorResponse{Err: "channel_not_found"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{slackapi.SlackErrorResponse{Err: "channel_not_found"}, "channel_not_found"},
+		{&slackapi.RateLimitedError{RetryAfter: time.Second}, "ratelimited"},
+		{slackapi.StatusCodeError{Code: 503, Status: "503 Service Unavailable"}, "http_503"},
+		{context.DeadlineExceeded, "timeout"},
+		{io.ErrUnexpectedEOF, "transport"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := ErrorCode(tt.err); got != tt.want {
+				t.Errorf("ErrorCode(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
 }
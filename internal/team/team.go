@@ -0,0 +1,59 @@
+package team
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Member is a developer sharing the server in team mode.
+type Member struct {
+	// SlackID is the member's Slack user ID, mentioned in notifications.
+	SlackID string `yaml:"slack_id"`
+	// DM sends the member's sessions to a DM instead of the default channel.
+	// Routes still take precedence.
+	DM bool `yaml:"dm"`
+	// Delegates are Slack user IDs that may also reply to the member's sessions.
+	Delegates []string `yaml:"delegates"`
+}
+
+// Directory maps the identity sent by the hook client, such as the OS
+// user name, to a member.
+type Directory map[string]Member
+
+// Lookup returns the member for identity.
+func (d Directory) Lookup(identity string) (Member, bool) {
+	if identity == "" {
+		return Member{}, false
+	}
+	m, ok := d[identity]
+	return m, ok
+}
+
+// CanReply reports whether the Slack user may reply to the member's sessions.
+func (m Member) CanReply(slackUser string) bool {
+	return slackUser == m.SlackID || slices.Contains(m.Delegates, slackUser)
+}
+
+// Validate checks that all members have valid Slack user IDs.
+func (d Directory) Validate() error {
+	var errs []error
+	for _, identity := range slices.Sorted(maps.Keys(d)) {
+		m := d[identity]
+		if !isUserID(m.SlackID) {
+			errs = append(errs, fmt.Errorf("users.%s: slack_id must be a user ID (U...), got %q", identity, m.SlackID))
+		}
+		for _, u := range m.Delegates {
+			if !isUserID(u) {
+				errs = append(errs, fmt.Errorf("users.%s: delegate must be a user ID (U...), got %q", identity, u))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isUserID(id string) bool {
+	return strings.HasPrefix(id, "U") || strings.HasPrefix(id, "W")
+}
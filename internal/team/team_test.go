@@ -0,0 +1,59 @@
+package team
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	d := Directory{"alice": {SlackID: "U111"}}
+
+	if m, ok := d.Lookup("alice"); !ok || m.SlackID != "U111" {
+		t.Errorf("Lookup(alice) = %+v (ok=%v)", m, ok)
+	}
+	if _, ok := d.Lookup("bob"); ok {
+		t.Error("unknown identity should not be found")
+	}
+	if _, ok := d.Lookup(""); ok {
+		t.Error("empty identity should not be found")
+	}
+}
+
+func TestCanReply(t *testing.T) {
+	m := Member{SlackID: "U111", Delegates: []string{"U222"}}
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{"U111", true},
+		{"U222", true},
+		{"U333", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := m.CanReply(tt.user); got != tt.want {
+			t.Errorf("CanReply(%q) = %v, want %v", tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Directory{"alice": {SlackID: "U111", Delegates: []string{"W222"}}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := Directory{
+		"alice": {SlackID: ""},
+		"bob":   {SlackID: "U222", Delegates: []string{"carol"}},
+	}
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{"users.alice: slack_id", `users.bob: delegate must be a user ID (U...), got "carol"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %q, want it to contain %q", err, want)
+		}
+	}
+}
@@ -5,10 +5,31 @@ import (
 	"os/exec"
 )
 
+// Key is a keystroke sent to a pane: either a tmux key name such as
+// "Enter" or "Down", or literal text.
+type Key struct {
+	Name string
+	Text string
+}
+
+// Named returns the key called name.
+func Named(name string) Key { return Key{Name: name} }
+
+// Literal returns text to be typed as is.
+func Literal(text string) Key { return Key{Text: text} }
+
+func (k Key) String() string {
+	if k.Name != "" {
+		return k.Name
+	}
+	return fmt.Sprintf("%q", k.Text)
+}
+
 // SendKeys sends a message to the specified tmux target pane.
 // The message and Enter keystroke are sent as separate send-keys commands.
+// The message is sent literally, even if it looks like a key name.
 func SendKeys(target, message string) error {
-	if err := exec.Command("tmux", "send-keys", "-t", target, message).Run(); err != nil {
+	if err := exec.Command("tmux", "send-keys", "-t", target, "-l", message).Run(); err != nil {
 		return fmt.Errorf("tmux send-keys message: %w", err)
 	}
 	if err := exec.Command("tmux", "send-keys", "-t", target, "Enter").Run(); err != nil {
@@ -16,3 +37,60 @@ func SendKeys(target, message string) error {
 	}
 	return nil
 }
+
+// Send sends keys to the specified tmux target pane in order. Consecutive
+// named keys are sent by one send-keys command; literal text is sent with
+// -l so that it is never taken for a key name.
+func Send(target string, keys ...Key) error {
+	var names []string
+	flush := func() error {
+		if len(names) == 0 {
+			return nil
+		}
+		args := append([]string{"send-keys", "-t", target}, names...)
+		names = nil
+		if err := exec.Command("tmux", args...).Run(); err != nil {
+			return fmt.Errorf("tmux send-keys: %w", err)
+		}
+		return nil
+	}
+	for _, k := range keys {
+		if k.Name != "" {
+			names = append(names, k.Name)
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := exec.Command("tmux", "send-keys", "-t", target, "-l", k.Text).Run(); err != nil {
+			return fmt.Errorf("tmux send-keys text: %w", err)
+		}
+	}
+	return flush()
+}
+
+// CaptureOptions select what CapturePane returns.
+type CaptureOptions struct {
+	// History is the number of scrollback lines included.
+	History int
+	// Escapes keeps the escape sequences for colours and attributes.
+	Escapes bool
+	// Join joins lines wrapped at the pane width into one line.
+	Join bool
+}
+
+// CapturePane returns the contents of the specified tmux target pane.
+func CapturePane(target string, opts CaptureOptions) (string, error) {
+	args := []string{"capture-pane", "-p", "-t", target, "-S", fmt.Sprint(-opts.History)}
+	if opts.Escapes {
+		args = append(args, "-e")
+	}
+	if opts.Join {
+		args = append(args, "-J")
+	}
+	out, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("tmux capture-pane: %w", err)
+	}
+	return string(out), nil
+}